@@ -5,9 +5,13 @@ import (
 	"os"
 
 	"gni.dev/cmd/internal/build"
+	"gni.dev/cmd/internal/clean"
 	"gni.dev/cmd/internal/dbg/dap"
 	"gni.dev/cmd/internal/dbg/term"
+	"gni.dev/cmd/internal/dist"
+	"gni.dev/cmd/internal/keygen"
 	"gni.dev/cmd/internal/run"
+	"gni.dev/cmd/internal/symbolize"
 )
 
 func main() {
@@ -21,10 +25,28 @@ func main() {
 		build.Run(os.Args[2:])
 	case "run":
 		run.Run(os.Args[2:])
+	case "devices":
+		run.Devices(os.Args[2:])
+	case "data":
+		run.Data(os.Args[2:])
+	case "screenshot":
+		run.Screenshot(os.Args[2:])
+	case "record":
+		run.Record(os.Args[2:])
+	case "emulator":
+		run.Emulator(os.Args[2:])
 	case "debug":
 		term.Run(os.Args[2:])
 	case "dap":
 		dap.Run(os.Args[2:])
+	case "package":
+		dist.Run(os.Args[2:])
+	case "clean":
+		clean.Run(os.Args[2:])
+	case "symbolize":
+		symbolize.Run(os.Args[2:])
+	case "keygen":
+		keygen.Run(os.Args[2:])
 	default:
 		fmt.Fprintln(os.Stderr, "Unknown command:", os.Args[1])
 		os.Exit(1)
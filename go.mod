@@ -1,11 +1,15 @@
 module gni.dev/cmd
 
-go 1.18
+go 1.19
 
-require github.com/stretchr/testify v1.8.4
+require (
+	github.com/stretchr/testify v1.8.4
+	software.sslmate.com/src/go-pkcs12 v0.4.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/crypto v0.11.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -11,3 +11,13 @@ var archMap = map[string]targetArch{
 	"arm":   {"armeabi-v7a", "armv7a-linux-androideabi"},
 	"arm64": {"arm64-v8a", "aarch64-linux-android"},
 }
+
+// abiArch returns the GOARCH building for the Android ABI.
+func abiArch(abi string) (string, bool) {
+	for goarch, arch := range archMap {
+		if arch.abi == abi {
+			return goarch, true
+		}
+	}
+	return "", false
+}
@@ -2,6 +2,8 @@ package build
 
 import (
 	"flag"
+	"fmt"
+	"path"
 	"path/filepath"
 )
 
@@ -10,6 +12,27 @@ type Args struct {
 	outDir       string
 	debugBuild   bool
 	waitDebugger bool
+
+	tags     string
+	ldflags  string
+	gcflags  string
+	mod      string
+	trimpath bool
+	race     bool
+
+	gitVersion   bool
+	buildFormula string
+
+	patterns []string
+	pkg      string
+	abis     []string
+
+	variantName string
+	config      *Config
+	variant     Variant
+
+	keystore     string
+	keystorePass string
 }
 
 func CreateArgs(f *flag.FlagSet) *Args {
@@ -17,6 +40,15 @@ func CreateArgs(f *flag.FlagSet) *Args {
 	f.StringVar(&a.chdir, "C", ".", "Change working directory before building")
 	f.StringVar(&a.outDir, "o", "", "Output path. Default is out/")
 	f.BoolVar(&a.debugBuild, "debug", false, "Build on debug mode")
+	f.StringVar(&a.tags, "tags", "", "Comma-separated list of additional build tags")
+	f.StringVar(&a.ldflags, "ldflags", "", "Arguments to pass on each go tool link invocation")
+	f.StringVar(&a.gcflags, "gcflags", "", "Arguments to pass on each go tool compile invocation")
+	f.StringVar(&a.mod, "mod", "", "Module download mode to use: readonly, vendor, or mod")
+	f.BoolVar(&a.trimpath, "trimpath", false, "Remove all file system paths from the resulting executable")
+	f.BoolVar(&a.race, "race", false, "Enable data race detection")
+	f.BoolVar(&a.gitVersion, "gitversion", false, "Derive version from git tags and build number from buildformula")
+	f.StringVar(&a.variantName, "variant", "", "Build variant defined in "+ConfigFile)
+	f.StringVar(&a.buildFormula, "buildformula", defaultBuildFormula, "Template computing the build number from git version (Major, Minor, Patch, Ahead, Count)")
 	return &a
 }
 
@@ -24,10 +56,19 @@ func (a *Args) Chdir() string {
 	return a.chdir
 }
 
+// OutRoot returns the output path holding the trees of all variants and
+// build modes.
+func (a *Args) OutRoot() string {
+	if a.outDir == "" {
+		return "out"
+	}
+	return a.outDir
+}
+
 func (a *Args) OutDir() string {
-	out := a.outDir
-	if out == "" {
-		out = "out"
+	out := a.OutRoot()
+	if a.variantName != "" {
+		out = filepath.Join(out, a.variantName)
 	}
 	if a.debugBuild {
 		return filepath.Join(out, "debug")
@@ -37,13 +78,121 @@ func (a *Args) OutDir() string {
 }
 
 func (a *Args) BuildDir() string {
-	return filepath.Join(a.OutDir(), "gnibuild")
+	if a.pkg == "" {
+		return filepath.Join(a.OutDir(), "gnibuild")
+	}
+	return filepath.Join(a.OutDir(), "gnibuild", path.Base(a.pkg))
+}
+
+// APK returns the path to the signed APK of the app described by m.
+func (a *Args) APK(m Metadata) string {
+	return filepath.Join(a.OutDir(), a.ArtifactName(m)+".apk")
+}
+
+// ArtifactName returns the base of the file names of the artifacts of the
+// app described by m: the last element of its package path, unique among
+// the main packages built together, and the variant. The display name of
+// the app is left out, variants may give all the apps the same one.
+func (a *Args) ArtifactName(m Metadata) string {
+	name := path.Base(m.Package)
+	if a.variantName != "" {
+		name += "-" + a.variantName
+	}
+	return name
+}
+
+// ABIs returns the Android ABIs to build for. Default is x86_64.
+func (a *Args) ABIs() []string {
+	if len(a.abis) == 0 {
+		return []string{archMap["amd64"].abi}
+	}
+	return a.abis
+}
+
+// SetABIs sets the Android ABIs to build for.
+func (a *Args) SetABIs(abis []string) error {
+	for _, abi := range abis {
+		if _, ok := abiArch(abi); !ok {
+			return fmt.Errorf("unsupported ABI %s", abi)
+		}
+	}
+	a.abis = abis
+	return nil
 }
 
 func (a *Args) DebugBuild() bool {
 	return a.debugBuild
 }
 
+// SetDebugBuild overrides the -debug flag.
+func (a *Args) SetDebugBuild(debug bool) {
+	a.debugBuild = debug
+}
+
 func (a *Args) WaitDebugger(wait bool) {
 	a.waitDebugger = wait
 }
+
+// SetPatterns sets the package patterns given on the command line.
+func (a *Args) SetPatterns(patterns []string) {
+	a.patterns = patterns
+}
+
+// Package returns the main package to build.
+func (a *Args) Package() string {
+	if a.pkg == "" {
+		return "."
+	}
+	return a.pkg
+}
+
+// WithPackage returns a copy of a building the main package pkg.
+func (a *Args) WithPackage(pkg string) *Args {
+	c := *a
+	c.pkg = pkg
+	return &c
+}
+
+// LoadConfig reads the project configuration and resolves the selected
+// variant. It must be called after changing to the project directory.
+func (a *Args) LoadConfig() error {
+	c, err := ReadConfig()
+	if err != nil {
+		return err
+	}
+	v, err := c.variant(a.variantName)
+	if err != nil {
+		return err
+	}
+	a.config = c
+	a.variant = v
+	return nil
+}
+
+// Config returns the project configuration loaded by LoadConfig.
+func (a *Args) Config() *Config {
+	if a.config == nil {
+		return &Config{}
+	}
+	return a.config
+}
+
+// SetKeystore makes release builds signed with the key of the PKCS#12
+// keystore file instead of the debug key.
+func (a *Args) SetKeystore(file, password string) {
+	a.keystore = file
+	a.keystorePass = password
+}
+
+// Keystore returns the keystore set by SetKeystore. It is empty if release
+// builds use the debug key.
+func (a *Args) Keystore() string {
+	return a.keystore
+}
+
+func (a *Args) icon() string {
+	if a.variant.Icon != "" {
+		return a.variant.Icon
+	}
+	return a.Config().Icon
+}
@@ -0,0 +1,112 @@
+package build
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// backendVars are the string variables of the backend package set with -X
+// by the linker flags. The linker silently ignores -X for a variable that
+// doesn't exist, so checkBackendVars makes sure they do.
+var backendVars = []string{
+	"appID",
+	"appName",
+	"appVersion",
+	"appBuild",
+	"appCommit",
+	"appBuildTime",
+	"waitDebugger",
+}
+
+// Versions of the backend package, which declares the current one as the
+// integer constant backendVersion. Backends without it are version 0.
+const (
+	// BackendLibOverride backends load code_cache/libgni.so in debug
+	// builds, instead of the library of the APK.
+	BackendLibOverride = 1
+	// BackendIndexedExtras backends read the program arguments and the
+	// environment from one launch extra per value.
+	BackendIndexedExtras = 2
+)
+
+// BackendVersion returns the version of the backend package in dir.
+func BackendVersion(dir string) (int, error) {
+	decls, err := backendDecls(dir)
+	if err != nil {
+		return 0, err
+	}
+	spec, ok := decls["backendVersion"]
+	if !ok || spec.tok != token.CONST || spec.value == nil {
+		return 0, nil
+	}
+	lit, ok := spec.value.(*ast.BasicLit)
+	if !ok || lit.Kind != token.INT {
+		return 0, fmt.Errorf("backendVersion of %s at %s is not an integer literal", backendPkg, dir)
+	}
+	v, err := strconv.Atoi(lit.Value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid backendVersion of %s at %s: %w", backendPkg, dir, err)
+	}
+	return v, nil
+}
+
+// checkBackendVars fails if the Go files of the backend package in dir
+// don't declare all the backendVars.
+func checkBackendVars(dir string) error {
+	decls, err := backendDecls(dir)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, v := range backendVars {
+		if decls[v].tok != token.VAR {
+			missing = append(missing, v)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s at %s lacks the variables %s set by gni, update gni.dev/gni and gni.dev/cmd together", backendPkg, dir, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// backendDecl is a package level variable or constant.
+type backendDecl struct {
+	tok token.Token
+	// value is the expression given to the name, if any.
+	value ast.Expr
+}
+
+// backendDecls returns the package level variables and constants declared
+// by the Go files in dir.
+func backendDecls(dir string) (map[string]backendDecl, error) {
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	decls := make(map[string]backendDecl)
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.VAR && gen.Tok != token.CONST {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					vs := spec.(*ast.ValueSpec)
+					for i, name := range vs.Names {
+						d := backendDecl{tok: gen.Tok}
+						if i < len(vs.Values) {
+							d.value = vs.Values[i]
+						}
+						decls[name.Name] = d
+					}
+				}
+			}
+		}
+	}
+	return decls, nil
+}
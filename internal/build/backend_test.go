@@ -0,0 +1,90 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLdflagsBackendVars(t *testing.T) {
+	bt := time.Unix(1700000000, 0)
+	m := Metadata{AppID: "dev.gni.app", Name: "app", Version: "1.0", Build: 2, Commit: "abc", BuildTime: &bt}
+	a := &Args{debugBuild: true, waitDebugger: true}
+	var set []string
+	for _, f := range goBuildFlags(a, m) {
+		for _, x := range strings.Split(f, "-X '")[1:] {
+			name := strings.TrimPrefix(x[:strings.Index(x, "=")], backendPkg+".")
+			set = append(set, name)
+		}
+	}
+	assert.ElementsMatch(t, backendVars, set)
+}
+
+func TestCheckBackendVars(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{
+			src: `package backend
+
+var (
+	appID, appName, appVersion string
+	appBuild                   string
+	appCommit, appBuildTime    string
+)
+
+var waitDebugger = "false"
+`,
+		},
+		{
+			src: `package backend
+
+var appID, appName, appVersion, appBuild, appBuildTime string
+
+func waitDebugger() {}
+`,
+			err: "lacks the variables appCommit, waitDebugger",
+		},
+	}
+	for i, test := range tests {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "backend.go"), []byte(test.src), 0o644))
+		err := checkBackendVars(dir)
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, "test #%d", i)
+		} else {
+			assert.NoError(t, err, "test #%d", i)
+		}
+	}
+}
+
+func TestBackendVersion(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int
+		err  string
+	}{
+		{src: "package backend\n", want: 0},
+		{src: "package backend\n\nconst backendVersion = 2\n", want: 2},
+		{src: "package backend\n\nconst (\n\tother = 1\n\tbackendVersion = 3\n)\n", want: 3},
+		{src: "package backend\n\nvar backendVersion = 2\n", want: 0},
+		{src: "package backend\n\nconst backendVersion = \"2\"\n", err: "not an integer literal"},
+	}
+	for i, test := range tests {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "backend.go"), []byte(test.src), 0o644))
+		v, err := BackendVersion(dir)
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, "test #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "test #%d", i)
+		assert.Equal(t, test.want, v, "test #%d", i)
+	}
+}
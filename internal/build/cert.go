@@ -0,0 +1,143 @@
+package build
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// KeystorePasswordEnv is the environment variable holding the password of
+// the release keystore.
+const KeystorePasswordEnv = "GNI_KEYSTORE_PASSWORD"
+
+// GenerateKey generates a signing key. alg is either "rsa", in which case
+// bits is the key size, or "ec" for a P-256 key.
+func GenerateKey(alg string, bits int) (crypto.Signer, error) {
+	switch alg {
+	case "rsa":
+		return rsa.GenerateKey(rand.Reader, bits)
+	case "ec":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm %q", alg)
+	}
+}
+
+// NewCertificate creates a self-signed certificate for key, valid for the
+// given number of years starting from notBefore.
+func NewCertificate(key crypto.Signer, subject pkix.Name, notBefore time.Time, years int) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 63))
+	if err != nil {
+		return nil, err
+	}
+	usage := x509.KeyUsageDigitalSignature
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		usage |= x509.KeyUsageKeyEncipherment
+	}
+	ca := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.AddDate(years, 0, 0),
+		KeyUsage:     usage,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, ca, ca, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// DebugKey returns the paths to the DER encoded certificate and PKCS#8 key
+// used to sign debug builds. They are created once per user, so that apps
+// can be upgraded in place and keep their data across builds.
+func DebugKey() (string, string, error) {
+	cfgDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", "", err
+	}
+	dir := filepath.Join(cfgDir, "gni")
+	certFile := filepath.Join(dir, "debug.crt")
+	keyFile := filepath.Join(dir, "debug.key")
+
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if certErr == nil && keyErr == nil {
+		return certFile, keyFile, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	key, err := GenerateKey("rsa", 2048)
+	if err != nil {
+		return "", "", err
+	}
+	cert, err := NewCertificate(key, pkix.Name{CommonName: "Android Debug"}, time.Now(), 30)
+	if err != nil {
+		return "", "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(keyFile, der, 0600); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(certFile, cert.Raw, 0644); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+// LoadKeystore returns the key and certificate of a PKCS#12 keystore, as
+// written by gni keygen.
+func LoadKeystore(file, password string) (crypto.Signer, *x509.Certificate, error) {
+	if password == "" {
+		return nil, nil, fmt.Errorf("password of keystore %s is required, set $%s", file, KeystorePasswordEnv)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, cert, _, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read keystore %s: %w", file, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("unsupported key type in keystore " + file)
+	}
+	return signer, cert, nil
+}
+
+// writeSigningKey writes key and cert to dir in the formats of apksigner
+// and returns the paths of the certificate and key files.
+func writeSigningKey(dir string, key crypto.Signer, cert *x509.Certificate) (string, string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	certFile := filepath.Join(dir, "release.crt")
+	keyFile := filepath.Join(dir, "release.key")
+	if err := os.WriteFile(keyFile, der, 0600); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(certFile, cert.Raw, 0644); err != nil {
+		os.Remove(keyFile)
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
@@ -0,0 +1,46 @@
+package build
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestLoadKeystore(t *testing.T) {
+	key, err := GenerateKey("ec", 0)
+	require.NoError(t, err)
+	cert, err := NewCertificate(key, pkix.Name{CommonName: "Release"}, time.Now(), 1)
+	require.NoError(t, err)
+	pfx, err := pkcs12.Modern.Encode(key, cert, nil, "secret")
+	require.NoError(t, err)
+	ks := filepath.Join(t.TempDir(), "release.p12")
+	require.NoError(t, os.WriteFile(ks, pfx, 0o600))
+
+	_, _, err = LoadKeystore(ks, "")
+	assert.ErrorContains(t, err, KeystorePasswordEnv)
+	_, _, err = LoadKeystore(ks, "wrong")
+	assert.ErrorContains(t, err, "failed to read keystore")
+
+	gotKey, gotCert, err := LoadKeystore(ks, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, cert.Raw, gotCert.Raw)
+	assert.Equal(t, key.Public(), gotKey.Public())
+
+	dir := t.TempDir()
+	certFile, keyFile, err := writeSigningKey(dir, gotKey, gotCert)
+	require.NoError(t, err)
+	der, err := os.ReadFile(keyFile)
+	require.NoError(t, err)
+	_, err = x509.ParsePKCS8PrivateKey(der)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(certFile)
+	require.NoError(t, err)
+	assert.Equal(t, cert.Raw, data)
+}
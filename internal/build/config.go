@@ -0,0 +1,80 @@
+package build
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ConfigFile is the name of the project configuration file, looked up in
+// the working directory.
+const ConfigFile = "gni.json"
+
+type Config struct {
+	// Icon is the path to the PNG launcher icon.
+	Icon string `json:"icon,omitempty"`
+	// Keystore is the path to the PKCS#12 keystore signing the packages of
+	// gni package. Its password is read from $GNI_KEYSTORE_PASSWORD.
+	Keystore string             `json:"keystore,omitempty"`
+	Variants map[string]Variant `json:"variants,omitempty"`
+	Hooks    *Hooks             `json:"hooks,omitempty"`
+	Ports    *Ports             `json:"ports,omitempty"`
+}
+
+// Ports are the port mappings set up by gni run for the session. A mapping
+// is a port number, for the same TCP port on both sides, or two adb socket
+// specs in the order of the adb command, like "tcp:8080 localabstract:app".
+type Ports struct {
+	// Reverse maps device ports to workstation ports, like adb reverse.
+	Reverse []string `json:"reverse,omitempty"`
+	// Forward maps workstation ports to device ports, like adb forward.
+	Forward []string `json:"forward,omitempty"`
+}
+
+// Variant is a named flavor of the app, e.g. dev, staging or prod.
+type Variant struct {
+	// AppIDSuffix is appended to the AppID so variants can be installed
+	// side by side.
+	AppIDSuffix string `json:"appIDSuffix,omitempty"`
+	// Name overrides the app name.
+	Name    string `json:"name,omitempty"`
+	Tags    string `json:"tags,omitempty"`
+	Ldflags string `json:"ldflags,omitempty"`
+	Icon    string `json:"icon,omitempty"`
+}
+
+// ReadConfig reads the project configuration from ConfigFile. A missing
+// file results in an empty configuration.
+func ReadConfig() (*Config, error) {
+	var c Config
+	data, err := os.ReadFile(ConfigFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return &c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ConfigFile, err)
+	}
+	return &c, nil
+}
+
+func (c *Config) variant(name string) (Variant, error) {
+	if name == "" {
+		return Variant{}, nil
+	}
+	v, ok := c.Variants[name]
+	if !ok {
+		names := make([]string, 0, len(c.Variants))
+		for n := range c.Variants {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Variant{}, fmt.Errorf("unknown variant %q, available: %s", name, strings.Join(names, ", "))
+	}
+	return v, nil
+}
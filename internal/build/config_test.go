@@ -0,0 +1,159 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const variantConfig = `{
+	"icon": "icon.png",
+	"variants": {
+		"dev": {
+			"appIDSuffix": ".dev",
+			"name": "App Dev",
+			"tags": "dev",
+			"ldflags": "-X main.env=dev",
+			"icon": "dev.png"
+		},
+		"prod": {}
+	}
+}`
+
+func TestVariant(t *testing.T) {
+	c := &Config{Variants: map[string]Variant{
+		"dev":  {AppIDSuffix: ".dev"},
+		"prod": {Name: "App"},
+	}}
+	tests := []struct {
+		name string
+		want Variant
+		err  string
+	}{
+		{name: ""},
+		{name: "dev", want: Variant{AppIDSuffix: ".dev"}},
+		{name: "prod", want: Variant{Name: "App"}},
+		{name: "qa", err: `unknown variant "qa", available: dev, prod`},
+	}
+	for _, test := range tests {
+		v, err := c.variant(test.name)
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, test.name)
+			continue
+		}
+		if assert.NoError(t, err, test.name) {
+			assert.Equal(t, test.want, v, test.name)
+		}
+	}
+}
+
+func TestLoadConfigVariant(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":   "module example.com/app\n\ngo 1.18\n",
+		"main.go":  "package main\n\nfunc main() {}\n",
+		ConfigFile: variantConfig,
+	}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644))
+	}
+	chdir(t, dir)
+
+	tests := []struct {
+		variant string
+		tags    string
+		ldflags string
+		// wantTags and wantLdflags are the variant and user flags passed
+		// to go build, the variant ones first so the user's win.
+		wantTags    string
+		wantLdflags string
+		appID       string
+		name        string
+		icon        string
+		outDir      string
+		apk         string
+		err         string
+	}{
+		{
+			appID:  "com.example.app",
+			name:   "app",
+			icon:   "icon.png",
+			outDir: filepath.Join("out", "release"),
+			apk:    "app.apk",
+		},
+		{
+			variant: "prod",
+			appID:   "com.example.app",
+			name:    "app",
+			icon:    "icon.png",
+			outDir:  filepath.Join("out", "prod", "release"),
+			apk:     "app-prod.apk",
+		},
+		{
+			variant:     "dev",
+			wantTags:    "dev",
+			wantLdflags: "-X main.env=dev",
+			appID:       "com.example.app.dev",
+			name:        "App Dev",
+			icon:        "dev.png",
+			outDir:      filepath.Join("out", "dev", "release"),
+			apk:         "app-dev.apk",
+		},
+		{
+			variant:     "dev",
+			tags:        "netgo",
+			ldflags:     "-X main.env=local",
+			wantTags:    "dev,netgo",
+			wantLdflags: "-X main.env=dev -X main.env=local",
+			appID:       "com.example.app.dev",
+			name:        "App Dev",
+			icon:        "dev.png",
+			outDir:      filepath.Join("out", "dev", "release"),
+			apk:         "app-dev.apk",
+		},
+		{
+			variant: "staging",
+			err:     `unknown variant "staging", available: dev, prod`,
+		},
+	}
+	for _, test := range tests {
+		a := &Args{variantName: test.variant, tags: test.tags, ldflags: test.ldflags}
+		err := a.LoadConfig()
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, test.variant)
+			continue
+		}
+		if !assert.NoError(t, err, test.variant) {
+			continue
+		}
+		assert.Equal(t, test.icon, a.icon(), test.variant)
+		assert.Equal(t, test.outDir, a.OutDir(), test.variant)
+
+		m, err := NewMetadata(a)
+		if !assert.NoError(t, err, test.variant) {
+			continue
+		}
+		assert.Equal(t, test.appID, m.AppID, test.variant)
+		assert.Equal(t, test.name, m.Name, test.variant)
+		// the file names don't use the display name of the variant
+		assert.Equal(t, filepath.Join(test.outDir, test.apk), a.APK(m), test.variant)
+
+		flags := goBuildFlags(a, m)
+		if test.wantTags != "" {
+			assert.Contains(t, flags, "-tags="+test.wantTags, test.variant)
+		}
+		assert.True(t, strings.HasSuffix(flags[len(flags)-1], test.wantLdflags), test.variant)
+	}
+}
+
+// chdir changes the working directory to dir for the duration of the test.
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+}
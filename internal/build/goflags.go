@@ -0,0 +1,119 @@
+package build
+
+import "strings"
+
+const backendPkg = "gni.dev/gni/internal/backend"
+
+// goListFlags returns the flags that affect package loading and therefore
+// must be passed to every go command operating on the user's packages.
+func goListFlags(a *Args) []string {
+	var flags []string
+	if tags := joinNonEmpty(",", a.variant.Tags, a.tags); tags != "" {
+		flags = append(flags, "-tags="+tags)
+	}
+	if a.mod != "" {
+		flags = append(flags, "-mod="+a.mod)
+	}
+	return flags
+}
+
+// goBuildFlags returns the go build flags for a, merging the flags gni
+// needs for the selected build mode with the ones given by the user.
+func goBuildFlags(a *Args, m Metadata) []string {
+	var gcflags []string
+	ldflags := m.ldflags()
+	if a.DebugBuild() {
+		gcflags = append(gcflags, "-N", "-l")
+		if a.waitDebugger {
+			ldflags = append(ldflags, ldflagsX(backendPkg+".waitDebugger", "true"))
+		}
+	}
+
+	flags := goListFlags(a)
+	if a.trimpath {
+		flags = append(flags, "-trimpath")
+	}
+	if a.race {
+		flags = append(flags, "-race")
+	}
+	for _, f := range mergePkgFlags("all", gcflags, a.gcflags) {
+		flags = append(flags, "-gcflags="+f)
+	}
+	for _, f := range mergePkgFlags("", ldflags, joinNonEmpty(" ", a.variant.Ldflags, a.ldflags)) {
+		flags = append(flags, "-ldflags="+f)
+	}
+	return flags
+}
+
+// buildIDFlag makes the external linker add a GNU build-id to the library.
+// Release libraries are stripped after the build, keeping an unstripped
+// copy identified by the build-id for symbolication.
+const buildIDFlag = "-Wl,--build-id=sha1"
+
+// cgoLDFlags returns the CGO_LDFLAGS of the build, given the value of the
+// environment. The build-id goes there rather than in -extldflags, which a
+// user -ldflags=-extldflags=... would replace. Being last, it wins over a
+// user --build-id.
+func cgoLDFlags(env string) string {
+	return joinNonEmpty(" ", env, buildIDFlag)
+}
+
+// mergePkgFlags merges gni's own flags, applied to the packages matching
+// pattern, with a user supplied -gcflags or -ldflags value. The go command
+// lets the last matching flag win, so when the patterns differ the user
+// value is emitted last with gni's flags prepended to it.
+func mergePkgFlags(pattern string, own []string, user string) []string {
+	if user == "" {
+		if len(own) == 0 {
+			return nil
+		}
+		return []string{withPattern(pattern, strings.Join(own, " "))}
+	}
+	userPattern, userFlags := splitPkgFlags(user)
+	if len(own) == 0 {
+		return []string{user}
+	}
+	merged := withPattern(userPattern, strings.Join(own, " ")+" "+userFlags)
+	if userPattern == pattern {
+		return []string{merged}
+	}
+	return []string{withPattern(pattern, strings.Join(own, " ")), merged}
+}
+
+// splitPkgFlags splits a "pattern=flags" value the way the go command does.
+func splitPkgFlags(v string) (string, string) {
+	if strings.HasPrefix(v, "-") {
+		return "", v
+	}
+	if i := strings.Index(v, "="); i > 0 {
+		return v[:i], v[i+1:]
+	}
+	return "", v
+}
+
+func joinNonEmpty(sep string, elems ...string) string {
+	var res []string
+	for _, e := range elems {
+		if e != "" {
+			res = append(res, e)
+		}
+	}
+	return strings.Join(res, sep)
+}
+
+func withPattern(pattern, flags string) string {
+	if pattern == "" {
+		return flags
+	}
+	return pattern + "=" + flags
+}
+
+// ldflagsX returns a -X linker flag setting name to value, quoted so that
+// the go command keeps values with spaces as a single argument.
+func ldflagsX(name, value string) string {
+	q := "'"
+	if strings.Contains(value, "'") {
+		q = `"`
+	}
+	return "-X " + q + name + "=" + value + q
+}
@@ -0,0 +1,63 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var mergeTests = []struct {
+	pattern string
+	own     []string
+	user    string
+	want    []string
+}{
+	{
+		pattern: "all",
+		own:     []string{"-N", "-l"},
+		want:    []string{"all=-N -l"},
+	},
+	{
+		pattern: "all",
+		user:    "-m",
+		want:    []string{"-m"},
+	},
+	{
+		pattern: "all",
+		own:     []string{"-N", "-l"},
+		user:    "all=-m",
+		want:    []string{"all=-N -l -m"},
+	},
+	{
+		pattern: "all",
+		own:     []string{"-N", "-l"},
+		user:    "-m",
+		want:    []string{"all=-N -l", "-N -l -m"},
+	},
+	{
+		own:  []string{"-s", "-w"},
+		user: "-X 'main.version=1.0'",
+		want: []string{"-s -w -X 'main.version=1.0'"},
+	},
+}
+
+func TestMergePkgFlags(t *testing.T) {
+	for i, test := range mergeTests {
+		got := mergePkgFlags(test.pattern, test.own, test.user)
+		assert.Equal(t, test.want, got, "test #%d", i)
+	}
+}
+
+func TestCgoLDFlags(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{env: "", want: "-Wl,--build-id=sha1"},
+		{env: "-L/opt/lib", want: "-L/opt/lib -Wl,--build-id=sha1"},
+		{env: "-Wl,--build-id=none", want: "-Wl,--build-id=none -Wl,--build-id=sha1"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, cgoLDFlags(test.env), test.env)
+	}
+}
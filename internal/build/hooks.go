@@ -0,0 +1,129 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Hook names, in the order they run.
+const (
+	HookPreBuild    = "preBuild"
+	HookPostCompile = "postCompile"
+	HookPostPackage = "postPackage"
+	HookPostInstall = "postInstall"
+)
+
+// Hooks are shell commands run at the stages of the build pipeline.
+type Hooks struct {
+	PreBuild    []string `json:"preBuild,omitempty"`
+	PostCompile []string `json:"postCompile,omitempty"`
+	PostPackage []string `json:"postPackage,omitempty"`
+	PostInstall []string `json:"postInstall,omitempty"`
+}
+
+// HookContext describes the build to a hook. It is written as JSON to the
+// standard input of the hook and exported as GNI_* environment variables.
+type HookContext struct {
+	Hook      string   `json:"hook"`
+	Target    string   `json:"target"`
+	Debug     bool     `json:"debug"`
+	ABIs      []string `json:"abis"`
+	Artifacts []string `json:"artifacts,omitempty"`
+	Device    string   `json:"device,omitempty"`
+	Metadata  Metadata `json:"metadata"`
+}
+
+// commands returns the commands of the hook with the given name. h may be
+// nil.
+func (h *Hooks) commands(name string) []string {
+	if h == nil {
+		return nil
+	}
+	switch name {
+	case HookPreBuild:
+		return h.PreBuild
+	case HookPostCompile:
+		return h.PostCompile
+	case HookPostPackage:
+		return h.PostPackage
+	case HookPostInstall:
+		return h.PostInstall
+	default:
+		return nil
+	}
+}
+
+// NewHookContext returns the context for hooks of the given Android build.
+func NewHookContext(m Metadata, a *Args, artifacts ...string) HookContext {
+	abis := make([]string, 0, len(archMap))
+	for abi := range NativeLibs(a) {
+		abis = append(abis, abi)
+	}
+	if len(abis) == 0 {
+		abis = a.ABIs()
+	}
+	sort.Strings(abis)
+	return HookContext{
+		Target:    "android",
+		Debug:     a.DebugBuild(),
+		ABIs:      abis,
+		Artifacts: artifacts,
+		Metadata:  m,
+	}
+}
+
+// RunHook runs the commands of the hook with the given name. A failing
+// command aborts the pipeline.
+func (a *Args) RunHook(name string, ctx HookContext) error {
+	ctx.Hook = name
+	cmds := a.Config().Hooks.commands(name)
+	if len(cmds) == 0 {
+		return nil
+	}
+	input, err := json.Marshal(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range cmds {
+		fmt.Printf("Running %s hook: %s\n", name, c)
+		cmd := shellCommand(c)
+		cmd.Stdin = bytes.NewReader(input)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), ctx.env()...)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s hook %q failed: %w", name, c, err)
+		}
+	}
+	return nil
+}
+
+func (ctx *HookContext) env() []string {
+	return []string{
+		"GNI_HOOK=" + ctx.Hook,
+		"GNI_TARGET=" + ctx.Target,
+		"GNI_DEBUG=" + strconv.FormatBool(ctx.Debug),
+		"GNI_ABIS=" + strings.Join(ctx.ABIs, ","),
+		"GNI_ARTIFACTS=" + strings.Join(ctx.Artifacts, string(filepath.ListSeparator)),
+		"GNI_DEVICE=" + ctx.Device,
+		"GNI_APP_ID=" + ctx.Metadata.AppID,
+		"GNI_APP_NAME=" + ctx.Metadata.Name,
+		"GNI_VERSION=" + ctx.Metadata.Version,
+		"GNI_BUILD=" + strconv.Itoa(ctx.Metadata.Build),
+	}
+}
+
+func shellCommand(c string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", c)
+	}
+	return exec.Command("sh", "-c", c)
+}
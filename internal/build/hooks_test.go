@@ -0,0 +1,65 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are run by sh")
+	}
+	tests := []struct {
+		name  string
+		hooks *Hooks
+		hook  string
+		want  string
+		err   string
+	}{
+		{
+			name: "no hooks",
+			hook: HookPreBuild,
+		},
+		{
+			name:  "in order",
+			hooks: &Hooks{PreBuild: []string{`echo one >> "$LOG"`, `echo two >> "$LOG"`}},
+			hook:  HookPreBuild,
+			want:  "one\ntwo\n",
+		},
+		{
+			name:  "other stage",
+			hooks: &Hooks{PostPackage: []string{`echo package >> "$LOG"`}},
+			hook:  HookPostCompile,
+		},
+		{
+			name:  "context",
+			hooks: &Hooks{PostCompile: []string{`echo "$GNI_HOOK $GNI_APP_ID" >> "$LOG"`}},
+			hook:  HookPostCompile,
+			want:  "postCompile dev.gni.app\n",
+		},
+		{
+			name:  "failure stops",
+			hooks: &Hooks{PostInstall: []string{`echo one >> "$LOG"`, "false", `echo two >> "$LOG"`}},
+			hook:  HookPostInstall,
+			want:  "one\n",
+			err:   `postInstall hook "false" failed`,
+		},
+	}
+	for _, test := range tests {
+		log := filepath.Join(t.TempDir(), "log")
+		t.Setenv("LOG", log)
+		a := &Args{config: &Config{Hooks: test.hooks}}
+		err := a.RunHook(test.hook, HookContext{Metadata: Metadata{AppID: "dev.gni.app"}})
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, test.name)
+		} else {
+			assert.NoError(t, err, test.name)
+		}
+		got, _ := os.ReadFile(log)
+		assert.Equal(t, test.want, string(got), test.name)
+	}
+}
@@ -6,21 +6,52 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// appIDInvalidChars matches the characters not allowed in app ID segments.
+// Digits are allowed but not first, which fixAppIDSegment takes care of.
+var appIDInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_.]`)
+
 type Metadata struct {
-	AppID   string
-	Name    string
-	Build   int
-	Version string
-	Android struct {
-		MinSDK    int
-		TargetSDK int
+	AppID string `json:"appID"`
+	// Name is the display name of the app.
+	Name string `json:"name"`
+	// Package is the import path of the main package.
+	Package string `json:"package"`
+	Build   int    `json:"build"`
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	// BuildTime is nil if unknown.
+	BuildTime *time.Time `json:"buildTime,omitempty"`
+	Android   struct {
+		MinSDK    int `json:"minSDK"`
+		TargetSDK int `json:"targetSDK"`
+	} `json:"android"`
+}
+
+// NewMetadata returns the metadata of the app built with a.
+func NewMetadata(a *Args) (Metadata, error) {
+	m, err := DefaultMetadata(a)
+	if err != nil {
+		return Metadata{}, err
 	}
+	m.AppID += a.variant.AppIDSuffix
+	if a.variant.Name != "" {
+		m.Name = a.variant.Name
+	}
+	if a.gitVersion {
+		if err := m.VersionFromGit(a.buildFormula); err != nil {
+			return Metadata{}, err
+		}
+	}
+	m.FixupAndroidVer()
+	return m, m.Validate()
 }
 
-func DefaultMetadata() (Metadata, error) {
+func DefaultMetadata(a *Args) (Metadata, error) {
 	m := Metadata{Build: 1, Version: "0.0.1"}
 
 	cmd := exec.Command(
@@ -28,6 +59,8 @@ func DefaultMetadata() (Metadata, error) {
 		"list",
 		"-f", "{{.ImportPath}}",
 	)
+	cmd.Args = append(cmd.Args, goListFlags(a)...)
+	cmd.Args = append(cmd.Args, a.Package())
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		os.Stderr.Write(out)
@@ -40,21 +73,94 @@ func DefaultMetadata() (Metadata, error) {
 
 	parts := strings.Split(importPath, "/")
 	name := parts[len(parts)-1]
+	m.AppID = appIDFromImportPath(importPath)
+	m.Name = name
+	m.Package = importPath
+	m.Commit = gitCommit()
+	m.BuildTime = buildTime()
+	return m, nil
+}
+
+// appIDFromImportPath derives an app ID from the import path of the main
+// package: example.com/foo/app gives com.example.app.
+func appIDFromImportPath(importPath string) string {
+	parts := strings.Split(importPath, "/")
+	name := parts[len(parts)-1]
+	var id string
 	if len(parts) > 1 {
 		domain := strings.Split(parts[0], ".")
 		if len(domain) > 1 {
-			m.AppID = domain[len(domain)-1] + "." + domain[len(domain)-2] + "." + name
+			id = domain[len(domain)-1] + "." + domain[len(domain)-2] + "." + name
 		} else {
-			m.AppID = domain[0] + "." + name
+			id = domain[0] + "." + name
 		}
 	} else {
-		m.AppID = "local." + name
+		id = "local." + name
 	}
 
-	re := regexp.MustCompile(`[^A-Za-z_.]`)
-	m.AppID = re.ReplaceAllString(m.AppID, "_")
-	m.Name = name
-	return m, nil
+	segments := strings.Split(appIDInvalidChars.ReplaceAllString(id, "_"), ".")
+	for i, seg := range segments {
+		segments[i] = fixAppIDSegment(seg)
+	}
+	return strings.Join(segments, ".")
+}
+
+// ldflags returns the linker flags exposing m to the compiled program.
+// They set the string variables appID, appName, appVersion, appBuild,
+// appCommit and appBuildTime of the gni.dev/gni/internal/backend package,
+// which the gni backend reads back through its app info API. Empty values
+// are left out. The variables must be listed in backendVars.
+func (m *Metadata) ldflags() []string {
+	buildTime := ""
+	if m.BuildTime != nil {
+		buildTime = m.BuildTime.UTC().Format(time.RFC3339)
+	}
+	vars := []struct {
+		name, value string
+	}{
+		{"appID", m.AppID},
+		{"appName", m.Name},
+		{"appVersion", m.Version},
+		{"appBuild", strconv.Itoa(m.Build)},
+		{"appCommit", m.Commit},
+		{"appBuildTime", buildTime},
+	}
+	flags := make([]string, 0, len(vars))
+	for _, v := range vars {
+		if v.value == "" {
+			continue
+		}
+		flags = append(flags, ldflagsX(backendPkg+"."+v.name, v.value))
+	}
+	return flags
+}
+
+// gitCommit returns the commit hash of the working tree or an empty string
+// if it is not a git repository.
+func gitCommit() string {
+	out, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return string(bytes.TrimSpace(out))
+}
+
+// buildTime returns the time of the build so that building the same tree
+// twice gives the same binary: $SOURCE_DATE_EPOCH if set, else the time of
+// the git commit, else nil.
+func buildTime() *time.Time {
+	sec, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64)
+	if err != nil {
+		out, gerr := exec.Command("git", "log", "-1", "--format=%ct").Output()
+		if gerr != nil {
+			return nil
+		}
+		if sec, err = strconv.ParseInt(string(bytes.TrimSpace(out)), 10, 64); err != nil {
+			return nil
+		}
+	}
+	t := time.Unix(sec, 0).UTC()
+	return &t
 }
 
 func (m *Metadata) FixupAndroidVer() {
@@ -0,0 +1,59 @@
+package build
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTimeSourceDateEpoch(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	want := time.Unix(1700000000, 0).UTC()
+	assert.Equal(t, &want, buildTime())
+}
+
+func TestLdflagsBuildTime(t *testing.T) {
+	bt := time.Unix(1700000000, 0)
+	m := Metadata{AppID: "dev.gni.app", BuildTime: &bt}
+	assert.Contains(t, m.ldflags(), ldflagsX(backendPkg+".appBuildTime", "2023-11-14T22:13:20Z"))
+
+	m.BuildTime = nil
+	for _, f := range m.ldflags() {
+		assert.NotContains(t, f, "appBuildTime")
+	}
+}
+
+func TestMetadataJSONBuildTime(t *testing.T) {
+	m := Metadata{AppID: "dev.gni.app"}
+	data, err := json.Marshal(m)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "buildTime")
+
+	bt := time.Unix(1700000000, 0).UTC()
+	m.BuildTime = &bt
+	data, err = json.Marshal(m)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"buildTime":"2023-11-14T22:13:20Z"`)
+}
+
+func TestAppIDFromImportPath(t *testing.T) {
+	tests := []struct {
+		importPath string
+		want       string
+	}{
+		{"example.com/foo/app", "com.example.app"},
+		{"example.com/app2", "com.example.app2"},
+		{"example.com/2d", "com.example.x2d"},
+		{"github.com/user/my-app", "com.github.my_app"},
+		{"gopkg.in/yaml.v3", "in.gopkg.yaml.v3"},
+		{"app1", "local.app1"},
+		{"corp/new", "corp.new_"},
+	}
+	for _, test := range tests {
+		id := appIDFromImportPath(test.importPath)
+		assert.Equal(t, test.want, id, test.importPath)
+		assert.NoError(t, validateAppID(id), test.importPath)
+	}
+}
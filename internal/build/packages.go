@@ -0,0 +1,53 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// MainPackages returns the import paths of the main packages matched by
+// the patterns given on the command line, or by the current directory if
+// there are none. It fails if two packages would produce outputs with the
+// same name.
+func (a *Args) MainPackages() ([]string, error) {
+	patterns := a.patterns
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	cmd := exec.Command(
+		"go",
+		"list",
+		"-f", `{{if eq .Name "main"}}{{.ImportPath}}{{end}}`,
+	)
+	cmd.Args = append(cmd.Args, goListFlags(a)...)
+	cmd.Args = append(cmd.Args, patterns...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		os.Stderr.Write(out)
+		return nil, err
+	}
+
+	var pkgs []string
+	names := make(map[string]string)
+	for _, l := range strings.Split(string(bytes.TrimSpace(out)), "\n") {
+		pkg := strings.TrimSpace(l)
+		if pkg == "" {
+			continue
+		}
+		name := path.Base(pkg)
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("packages %s and %s produce the same output name %s", other, pkg, name)
+		}
+		names[name] = pkg
+		pkgs = append(pkgs, pkg)
+	}
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no main packages found in %s", strings.Join(patterns, " "))
+	}
+	return pkgs, nil
+}
@@ -27,25 +27,42 @@ func Run(args []string) {
 		}
 	}
 
-	m, err := DefaultMetadata()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
-	}
-	m.FixupAndroidVer()
-
+	var build func(Metadata, *Args) error
 	switch target {
 	case "android":
-		err = BuildAndroid(m, a)
+		build = BuildAndroid
 	case "ios":
-		err = BuildIOS(m, a)
+		build = BuildIOS
 	default:
 		fmt.Fprintln(os.Stderr, "Unknown target:", target)
 		os.Exit(1)
 	}
 
+	if err := a.LoadConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	a.SetPatterns(buildFlags.Args())
+	pkgs, err := a.MainPackages()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+
+	for _, pkg := range pkgs {
+		pa := a.WithPackage(pkg)
+		m, err := NewMetadata(pa)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if len(pkgs) > 1 {
+			fmt.Printf("Building package %s...\n", pkg)
+		}
+		if err := build(m, pa); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
 }
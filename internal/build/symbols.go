@@ -0,0 +1,142 @@
+package build
+
+import (
+	"debug/elf"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// SymbolsDir returns the directory keeping the unstripped native libraries
+// of the builds, keyed by their GNU build-id.
+func (a *Args) SymbolsDir() string {
+	return filepath.Join(a.OutDir(), "symbols")
+}
+
+// SymbolFile returns the path of the unstripped library with the given
+// build-id in the symbols directory dir.
+func SymbolFile(dir, buildID string) string {
+	return filepath.Join(dir, buildID, "libgni.so")
+}
+
+// ReadBuildID returns the GNU build-id of the ELF file at path.
+func ReadBuildID(path string) (string, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	s := f.Section(".note.gnu.build-id")
+	if s == nil {
+		return "", fmt.Errorf("%s has no GNU build-id", path)
+	}
+	note, err := s.Data()
+	if err != nil {
+		return "", err
+	}
+	if len(note) < 16 {
+		return "", fmt.Errorf("%s has malformed GNU build-id note", path)
+	}
+	nameSize := int(f.ByteOrder.Uint32(note[0:]))
+	descSize := int(f.ByteOrder.Uint32(note[4:]))
+	descOff := 12 + (nameSize+3)&^3
+	if descOff+descSize > len(note) {
+		return "", fmt.Errorf("%s has malformed GNU build-id note", path)
+	}
+	return hex.EncodeToString(note[descOff : descOff+descSize]), nil
+}
+
+// UnstrippedLibs returns the unstripped copies of NativeLibs by ABI.
+func UnstrippedLibs(a *Args) (map[string]string, error) {
+	libs := NativeLibs(a)
+	for abi, lib := range libs {
+		id, err := ReadBuildID(lib)
+		if err != nil {
+			return nil, err
+		}
+		sym := SymbolFile(a.SymbolsDir(), id)
+		if _, err := os.Stat(sym); err != nil {
+			return nil, err
+		}
+		libs[abi] = sym
+	}
+	return libs, nil
+}
+
+// saveSymbols copies the unstripped library lib to the symbols directory.
+func saveSymbols(a *Args, lib string) error {
+	id, err := ReadBuildID(lib)
+	if err != nil {
+		return err
+	}
+	dst := SymbolFile(a.SymbolsDir(), id)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	src, err := os.Open(lib)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// stripLib removes the symbol table and debug information from lib in
+// place. The build-id note is kept so crashes can be matched with the
+// unstripped copy.
+func stripLib(ndkBin, lib string) error {
+	strip := filepath.Join(ndkBin, "llvm-strip")
+	if runtime.GOOS == "windows" {
+		strip += ".exe"
+	}
+	cmd := exec.Command(strip, "--strip-all", lib)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Stderr.Write(out)
+		return err
+	}
+	return nil
+}
+
+// FindSymbols looks up the unstripped library with the given build-id in
+// the symbols directories of all output trees in outDir.
+func FindSymbols(outDir, buildID string) (string, error) {
+	var found []string
+	err := filepath.WalkDir(outDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || d.Name() != "symbols" {
+			return nil
+		}
+		if lib := SymbolFile(path, buildID); fileExists(lib) {
+			found = append(found, lib)
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(found) == 0 {
+		return "", fmt.Errorf("no symbols for build-id %s in %s", buildID, outDir)
+	}
+	return found[0], nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
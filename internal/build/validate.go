@@ -0,0 +1,112 @@
+package build
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// javaKeywords can't be used as AppID segments, since the AppID is also
+// the Java package of the generated R class.
+var javaKeywords = map[string]bool{
+	"abstract": true, "assert": true, "boolean": true, "break": true,
+	"byte": true, "case": true, "catch": true, "char": true,
+	"class": true, "const": true, "continue": true, "default": true,
+	"do": true, "double": true, "else": true, "enum": true,
+	"extends": true, "false": true, "final": true, "finally": true,
+	"float": true, "for": true, "goto": true, "if": true,
+	"implements": true, "import": true, "instanceof": true, "int": true,
+	"interface": true, "long": true, "native": true, "new": true,
+	"null": true, "package": true, "private": true, "protected": true,
+	"public": true, "return": true, "short": true, "static": true,
+	"strictfp": true, "super": true, "switch": true, "synchronized": true,
+	"this": true, "throw": true, "throws": true, "transient": true,
+	"true": true, "try": true, "void": true, "volatile": true,
+	"while": true,
+}
+
+// Validate checks m against the rules of the Android toolchain and Google
+// Play, so that bad values are reported before any build step runs.
+func (m *Metadata) Validate() error {
+	var errs []string
+	if err := validateAppID(m.AppID); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := validateName(m.Name); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if m.Build < 1 || m.Build > maxVersionCode {
+		errs = append(errs, fmt.Sprintf("build number %d is out of range [1, %d]", m.Build, maxVersionCode))
+	}
+	if m.Version == "" {
+		errs = append(errs, "version is empty")
+	} else if i := strings.IndexFunc(m.Version, unicode.IsControl); i != -1 {
+		errs = append(errs, fmt.Sprintf("version %q contains a control character at %d", m.Version, i))
+	}
+	if m.Android.MinSDK > m.Android.TargetSDK {
+		errs = append(errs, fmt.Sprintf("min SDK %d is greater than target SDK %d", m.Android.MinSDK, m.Android.TargetSDK))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid app metadata:\n\t%s", strings.Join(errs, "\n\t"))
+	}
+	return nil
+}
+
+func validateAppID(id string) error {
+	if id == "" {
+		return fmt.Errorf("app ID is empty")
+	}
+	segments := strings.Split(id, ".")
+	if len(segments) < 2 {
+		return fmt.Errorf("app ID %q must have at least two segments", id)
+	}
+	for i, seg := range segments {
+		if seg == "" {
+			return fmt.Errorf("app ID %q has an empty segment %d", id, i+1)
+		}
+		if !isASCIILetter(rune(seg[0])) {
+			return fmt.Errorf("app ID %q: segment %q must start with a letter", id, seg)
+		}
+		for _, r := range seg {
+			if !isASCIILetter(r) && !(r >= '0' && r <= '9') && r != '_' {
+				return fmt.Errorf("app ID %q: segment %q contains invalid character %q", id, seg, r)
+			}
+		}
+		if javaKeywords[seg] {
+			return fmt.Errorf("app ID %q: segment %q is a Java keyword", id, seg)
+		}
+	}
+	return nil
+}
+
+func validateName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("app name is empty")
+	}
+	if i := strings.IndexFunc(name, unicode.IsControl); i != -1 {
+		return fmt.Errorf("app name %q contains a control character at %d", name, i)
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("app name %q must not contain path separators", name)
+	}
+	if name[0] == '@' || name[0] == '?' {
+		return fmt.Errorf("app name %q must not start with %q, it would be read as a resource reference", name, name[0])
+	}
+	return nil
+}
+
+// fixAppIDSegment adjusts a segment derived from an import path so it
+// passes validateAppID.
+func fixAppIDSegment(seg string) string {
+	if seg == "" || !isASCIILetter(rune(seg[0])) {
+		seg = "x" + seg
+	}
+	if javaKeywords[seg] {
+		seg += "_"
+	}
+	return seg
+}
+
+func isASCIILetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
@@ -0,0 +1,53 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var appIDTests = []struct {
+	id   string
+	want string
+}{
+	{id: "com.example.app"},
+	{id: "com.example.app2_beta"},
+	{id: "", want: "empty"},
+	{id: "app", want: "at least two segments"},
+	{id: "com..app", want: "empty segment"},
+	{id: "com.example._app", want: "must start with a letter"},
+	{id: "com.example.2app", want: "must start with a letter"},
+	{id: "com.example.new", want: "Java keyword"},
+	{id: "com.exa-mple.app", want: "invalid character"},
+}
+
+func TestValidateAppID(t *testing.T) {
+	for i, test := range appIDTests {
+		err := validateAppID(test.id)
+		if test.want == "" {
+			assert.NoError(t, err, "test #%d", i)
+		} else {
+			assert.ErrorContains(t, err, test.want, "test #%d", i)
+		}
+	}
+}
+
+func TestValidateMetadata(t *testing.T) {
+	m := Metadata{AppID: "com.example.app", Name: "App", Build: 1, Version: "1.0"}
+	m.FixupAndroidVer()
+	assert.NoError(t, m.Validate())
+
+	m.Name = "@app_name"
+	m.Build = 0
+	m.Android.MinSDK = 40
+	err := m.Validate()
+	assert.ErrorContains(t, err, "resource reference")
+	assert.ErrorContains(t, err, "build number 0")
+	assert.ErrorContains(t, err, "min SDK 40")
+}
+
+func TestFixAppIDSegment(t *testing.T) {
+	for _, seg := range []string{"_app", "new", "", "ok"} {
+		assert.NoError(t, validateAppID("com."+fixAppIDSegment(seg)), seg)
+	}
+}
@@ -0,0 +1,157 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// maxVersionCode is the greatest versionCode accepted by Google Play.
+const maxVersionCode = 2100000000
+
+const defaultBuildFormula = "{{.Count}}"
+
+// gitVersion describes the working tree as reported by git.
+type gitVersion struct {
+	Tag   string
+	Major int
+	Minor int
+	Patch int
+	// Ahead is the number of commits since Tag.
+	Ahead int
+	// Count is the total number of commits reachable from HEAD.
+	Count int
+	Hash  string
+	Dirty bool
+}
+
+// Version returns the version name in the git describe format with the
+// leading "v" of the tag removed. Without a tag, it starts with 0.0.0.
+func (v gitVersion) Version() string {
+	ver := strings.TrimPrefix(v.Tag, "v")
+	if ver == "" {
+		ver = "0.0.0"
+	}
+	if v.Ahead > 0 {
+		ver += fmt.Sprintf("-%d-g%s", v.Ahead, v.Hash)
+	}
+	if v.Dirty {
+		ver += "-dirty"
+	}
+	return ver
+}
+
+// VersionFromGit sets m.Version from the latest git tag and m.Build from
+// formula, a template executed with the gitVersion of the working tree.
+func (m *Metadata) VersionFromGit(formula string) error {
+	v, err := describeGit()
+	if err != nil {
+		return err
+	}
+	build, err := evalBuildFormula(formula, v)
+	if err != nil {
+		return err
+	}
+	m.Version = v.Version()
+	m.Build = build
+	return nil
+}
+
+// describeGit returns the gitVersion of the working tree. Without a tag
+// reachable from HEAD, all the commits count as ahead of an empty tag.
+func describeGit() (gitVersion, error) {
+	count, err := git("rev-list", "--count", "HEAD")
+	if err != nil {
+		return gitVersion{}, fmt.Errorf("failed to describe version: %w", err)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return gitVersion{}, fmt.Errorf("invalid commit count %q", count)
+	}
+	tags, err := git("tag", "--merged", "HEAD")
+	if err != nil {
+		return gitVersion{}, err
+	}
+
+	var v gitVersion
+	if tags != "" {
+		desc, err := git("describe", "--tags", "--long", "--dirty")
+		if err != nil {
+			return gitVersion{}, fmt.Errorf("failed to describe version: %w", err)
+		}
+		if v, err = parseDescribe(desc); err != nil {
+			return gitVersion{}, err
+		}
+	} else {
+		if v.Hash, err = git("rev-parse", "--short", "HEAD"); err != nil {
+			return gitVersion{}, err
+		}
+		// like git describe --dirty, untracked files don't count
+		status, err := git("status", "--porcelain", "--untracked-files=no")
+		if err != nil {
+			return gitVersion{}, err
+		}
+		v.Ahead = n
+		v.Dirty = status != ""
+	}
+	v.Count = n
+	return v, nil
+}
+
+func parseDescribe(desc string) (gitVersion, error) {
+	var v gitVersion
+	s := desc
+	if strings.HasSuffix(s, "-dirty") {
+		v.Dirty = true
+		s = strings.TrimSuffix(s, "-dirty")
+	}
+	parts := strings.Split(s, "-")
+	if len(parts) < 3 || !strings.HasPrefix(parts[len(parts)-1], "g") {
+		return gitVersion{}, fmt.Errorf("unexpected git describe output %q", desc)
+	}
+	v.Hash = parts[len(parts)-1][1:]
+	ahead, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		return gitVersion{}, fmt.Errorf("unexpected git describe output %q", desc)
+	}
+	v.Ahead = ahead
+	v.Tag = strings.Join(parts[:len(parts)-2], "-")
+	fmt.Sscanf(strings.TrimPrefix(v.Tag, "v"), "%d.%d.%d", &v.Major, &v.Minor, &v.Patch)
+	return v, nil
+}
+
+func evalBuildFormula(formula string, v gitVersion) (int, error) {
+	if formula == "" {
+		formula = defaultBuildFormula
+	}
+	tmpl, err := template.New("build").Parse(formula)
+	if err != nil {
+		return 0, fmt.Errorf("invalid build formula: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, v); err != nil {
+		return 0, fmt.Errorf("invalid build formula: %w", err)
+	}
+	build, err := strconv.Atoi(strings.TrimSpace(buf.String()))
+	if err != nil {
+		return 0, fmt.Errorf("build formula %q produced %q, not a number", formula, buf.String())
+	}
+	if build < 1 || build > maxVersionCode {
+		return 0, fmt.Errorf("build number %d is out of range [1, %d]", build, maxVersionCode)
+	}
+	return build, nil
+}
+
+func git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
@@ -0,0 +1,111 @@
+package build
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var describeTests = []struct {
+	input    string
+	want     gitVersion
+	version  string
+	hasError bool
+}{
+	{
+		input:   "v1.2.3-0-gdeadbee",
+		want:    gitVersion{Tag: "v1.2.3", Major: 1, Minor: 2, Patch: 3, Hash: "deadbee"},
+		version: "1.2.3",
+	},
+	{
+		input:   "1.2-rc1-4-gdeadbee-dirty",
+		want:    gitVersion{Tag: "1.2-rc1", Major: 1, Minor: 2, Ahead: 4, Hash: "deadbee", Dirty: true},
+		version: "1.2-rc1-4-gdeadbee-dirty",
+	},
+	{
+		input:    "deadbee",
+		hasError: true,
+	},
+}
+
+func TestParseDescribe(t *testing.T) {
+	for i, test := range describeTests {
+		v, err := parseDescribe(test.input)
+		if test.hasError {
+			assert.Error(t, err, "test #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "test #%d", i)
+		assert.Equal(t, test.want, v, "test #%d", i)
+		assert.Equal(t, test.version, v.Version(), "test #%d", i)
+	}
+}
+
+func TestBuildFormula(t *testing.T) {
+	v := gitVersion{Major: 1, Minor: 2, Patch: 3, Count: 42}
+
+	build, err := evalBuildFormula("", v)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, build)
+
+	build, err = evalBuildFormula(`{{.Major}}{{printf "%02d%03d" .Minor .Patch}}`, v)
+	assert.NoError(t, err)
+	assert.Equal(t, 102003, build)
+
+	_, err = evalBuildFormula("{{.Hash}}", v)
+	assert.Error(t, err)
+
+	_, err = evalBuildFormula("3000000000", v)
+	assert.ErrorContains(t, err, "out of range")
+}
+
+func TestVersionFromGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	chdir(t, dir)
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	run := func(args ...string) string {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, "%s", out)
+		return string(out)
+	}
+	commit := func(content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte(content), 0o644))
+		run("add", "file")
+		run("-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", content)
+	}
+	version := func() Metadata {
+		var m Metadata
+		require.NoError(t, m.VersionFromGit(""))
+		return m
+	}
+
+	run("init", "-q")
+	commit("one")
+	commit("two")
+	hash := func() string {
+		out, err := git("rev-parse", "--short", "HEAD")
+		require.NoError(t, err)
+		return out
+	}
+
+	m := version()
+	assert.Equal(t, "0.0.0-2-g"+hash(), m.Version)
+	assert.Equal(t, 2, m.Build)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte("changed"), 0o644))
+	assert.Equal(t, "0.0.0-2-g"+hash()+"-dirty", version().Version)
+
+	run("tag", "v1.0.0")
+	commit("three")
+	m = version()
+	assert.Equal(t, "1.0.0-1-g"+hash(), m.Version)
+	assert.Equal(t, 3, m.Build)
+}
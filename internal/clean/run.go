@@ -0,0 +1,198 @@
+package clean
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// Subdirectories of an output tree such as out/debug.
+const buildDir = "gnibuild" // build intermediates, see build.Args.BuildDir
+
+// cacheDirs are the subdirectories of an output tree kept across builds:
+// the unstripped libraries by build-id, see build.Args.SymbolsDir, and
+// what gni run installed on each device.
+var cacheDirs = []string{"symbols", "installed"}
+
+func Run(args []string) {
+	var (
+		chdir  string
+		outDir string
+		build  bool
+		cache  bool
+		all    bool
+	)
+	cleanFlags := flag.NewFlagSet("clean", flag.ExitOnError)
+	cleanFlags.StringVar(&chdir, "C", ".", "Change working directory before cleaning")
+	cleanFlags.StringVar(&outDir, "o", "out", "Output path")
+	cleanFlags.BoolVar(&build, "build", false, "Remove build intermediates")
+	cleanFlags.BoolVar(&cache, "cache", false, "Remove the kept debug symbols and install state")
+	cleanFlags.BoolVar(&all, "all", false, "Remove the whole output directory")
+	if err := cleanFlags.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if chdir != "." {
+		if err := os.Chdir(chdir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if err := clean(outDir, build, cache, all); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func clean(outDir string, build, cache, all bool) error {
+	if err := checkOutDir(outDir); err != nil {
+		return err
+	}
+	trees, err := outputTrees(outDir)
+	if err != nil {
+		return err
+	}
+	if err := printUsage(trees); err != nil {
+		return err
+	}
+
+	var remove []string
+	switch {
+	case all:
+		remove = append(remove, outDir)
+	default:
+		for _, t := range trees {
+			if build {
+				remove = append(remove, filepath.Join(t, buildDir))
+			}
+			if cache {
+				for _, d := range cacheDirs {
+					remove = append(remove, filepath.Join(t, d))
+				}
+			}
+		}
+	}
+	for _, dir := range remove {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		fmt.Printf("Removing %s\n", dir)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOutDir makes sure outDir is inside the working directory, the
+// project, so that a mistyped -o can't remove anything else.
+func checkOutDir(outDir string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(outDir)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("refusing to clean %s, it is not inside the project directory %s", outDir, wd)
+	}
+	return nil
+}
+
+// outputTrees returns the debug and release output directories in outDir,
+// including the ones of build variants.
+func outputTrees(outDir string) ([]string, error) {
+	var trees []string
+	err := filepath.WalkDir(outDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == outDir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() || path == outDir {
+			return nil
+		}
+		switch d.Name() {
+		case "debug", "release":
+			trees = append(trees, path)
+			return filepath.SkipDir
+		case buildDir:
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return trees, err
+}
+
+func printUsage(trees []string) error {
+	if len(trees) == 0 {
+		fmt.Println("No build outputs found")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TREE\tBUILD\tCACHE\tTOTAL")
+	for _, t := range trees {
+		total, err := diskUsage(t)
+		if err != nil {
+			return err
+		}
+		build, err := diskUsage(filepath.Join(t, buildDir))
+		if err != nil {
+			return err
+		}
+		var cache int64
+		for _, d := range cacheDirs {
+			size, err := diskUsage(filepath.Join(t, d))
+			if err != nil {
+				return err
+			}
+			cache += size
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t, formatSize(build), formatSize(cache), formatSize(total))
+	}
+	return w.Flush()
+}
+
+func diskUsage(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
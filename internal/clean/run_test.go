@@ -0,0 +1,98 @@
+package clean
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tree is the project used by TestClean, with a file outside of it.
+var tree = []string{
+	"project/main.go",
+	"project/out/debug/app.apk",
+	"project/out/debug/gnibuild/libgni.so",
+	"project/out/debug/symbols/0123abcd/libgni.so",
+	"project/out/debug/installed/dev.gni.app/emulator-5554.json",
+	"project/out/dev/release/app.apk",
+	"project/out/dev/release/gnibuild/libgni.so",
+	"other/keep",
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		outDir  string
+		build   bool
+		cache   bool
+		all     bool
+		removed []string
+		err     string
+	}{
+		{outDir: "out"},
+		{
+			outDir:  "out",
+			build:   true,
+			removed: []string{"project/out/debug/gnibuild/libgni.so", "project/out/dev/release/gnibuild/libgni.so"},
+		},
+		{
+			outDir: "out",
+			cache:  true,
+			removed: []string{
+				"project/out/debug/installed/dev.gni.app/emulator-5554.json",
+				"project/out/debug/symbols/0123abcd/libgni.so",
+			},
+		},
+		{
+			outDir: "out",
+			all:    true,
+			removed: []string{
+				"project/out/debug/app.apk",
+				"project/out/debug/gnibuild/libgni.so",
+				"project/out/debug/installed/dev.gni.app/emulator-5554.json",
+				"project/out/debug/symbols/0123abcd/libgni.so",
+				"project/out/dev/release/app.apk",
+				"project/out/dev/release/gnibuild/libgni.so",
+			},
+		},
+		{outDir: ".", all: true, err: "refusing to clean ."},
+		{outDir: "..", all: true, err: "refusing to clean .."},
+		{outDir: string(filepath.Separator), all: true, err: "refusing to clean"},
+		{outDir: "../other", all: true, err: "refusing to clean ../other"},
+		{outDir: "out/../../other", build: true, err: "refusing to clean"},
+	}
+	for _, test := range tests {
+		root := t.TempDir()
+		for _, f := range tree {
+			path := filepath.Join(root, filepath.FromSlash(f))
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+			require.NoError(t, os.WriteFile(path, nil, 0o644))
+		}
+		chdir(t, filepath.Join(root, "project"))
+
+		err := clean(test.outDir, test.build, test.cache, test.all)
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, test.outDir)
+		} else {
+			assert.NoError(t, err, test.outDir)
+		}
+		var removed []string
+		for _, f := range tree {
+			if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(f))); os.IsNotExist(err) {
+				removed = append(removed, f)
+			}
+		}
+		sort.Strings(removed)
+		assert.Equal(t, test.removed, removed, test.outDir)
+	}
+}
+
+// chdir changes the working directory to dir for the duration of the test.
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+}
@@ -7,8 +7,10 @@ const (
 	parseErr
 	launchErr
 	setBreakpointsErr
+	continueErr
+	pauseErr
 )
 
 func (e gniDAPError) String() string {
-	return []string{"Processing error", "Parse error", "Failed to launch", "Failed to set breakpoints"}[e]
+	return []string{"Processing error", "Parse error", "Failed to launch", "Failed to set breakpoints", "Failed to continue", "Failed to pause"}[e]
 }
@@ -6,15 +6,20 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
 
 	"gni.dev/cmd/internal/dbg"
 	"gni.dev/cmd/internal/dbg/lldb"
 )
 
 type Session struct {
+	// mu serializes the messages written by the continue goroutine.
+	mu       sync.Mutex
 	rw       io.ReadWriter
 	handlers map[string]func(*request)
 	d        dbg.Debugger
+	// thread is the id of the thread that last stopped, guarded by mu.
+	thread int
 }
 
 func NewSession(rw io.ReadWriter) *Session {
@@ -23,11 +28,13 @@ func NewSession(rw io.ReadWriter) *Session {
 		"initialize":              s.onInitialize,
 		"disconnect":              s.onDisconnect,
 		"launch":                  s.onLaunch,
+		"attach":                  s.onAttach,
 		"setBreakpoints":          s.onSetBreakpoints,
 		"configurationDone":       s.onConfigurationDone,
 		"setExceptionBreakpoints": s.setExceptionBreakpoints,
 		"threads":                 s.onThreads,
 		"pause":                   s.onPause,
+		"continue":                s.onContinue,
 		"stackTrace":              s.onStackTrace,
 		"scopes":                  s.onScopes,
 		"variables":               s.onVariables,
@@ -82,6 +89,11 @@ func (s *Session) onLaunch(req *request) {
 	args := struct {
 		Program string   `json:"program"`
 		Args    []string `json:"args"`
+		// Target is "android" to debug the app on a device, Program is
+		// then the main package.
+		Target     string   `json:"target"`
+		Device     string   `json:"device"`
+		BuildFlags []string `json:"buildFlags"`
 	}{}
 	err := json.Unmarshal(req.Arguments, &args)
 	if err != nil {
@@ -89,6 +101,11 @@ func (s *Session) onLaunch(req *request) {
 		return
 	}
 
+	if args.Target == "android" {
+		s.startAndroid(req, androidArgs(args.Program, args.Device, args.BuildFlags, args.Args))
+		return
+	}
+
 	s.d, err = lldb.LaunchServer()
 	if err != nil {
 		s.replyErr(req, launchErr, err.Error(), true)
@@ -102,6 +119,56 @@ func (s *Session) onLaunch(req *request) {
 	s.reply(newResponse(req, nil))
 }
 
+// onAttach attaches to a running Android app.
+func (s *Session) onAttach(req *request) {
+	if s.d != nil {
+		s.replyErr(req, launchErr, "debugger already running", true)
+		return
+	}
+	args := struct {
+		Target     string   `json:"target"`
+		Program    string   `json:"program"`
+		Device     string   `json:"device"`
+		BuildFlags []string `json:"buildFlags"`
+	}{}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.replyErr(req, parseErr, err.Error(), false)
+		return
+	}
+	if args.Target != "android" {
+		s.replyErr(req, launchErr, fmt.Sprintf("attach is not supported for target '%s'", args.Target), true)
+		return
+	}
+	s.startAndroid(req, append([]string{"-attach"}, androidArgs(args.Program, args.Device, args.BuildFlags, nil)...))
+}
+
+// androidArgs returns the command line of gni debug android.
+func androidArgs(program, device string, buildFlags, args []string) []string {
+	runArgs := append([]string{}, buildFlags...)
+	if device != "" {
+		runArgs = append(runArgs, "-device", device)
+	}
+	if program != "" {
+		runArgs = append(runArgs, program)
+	}
+	if len(args) > 0 {
+		runArgs = append(append(runArgs, "--"), args...)
+	}
+	return runArgs
+}
+
+func (s *Session) startAndroid(req *request, args []string) {
+	var err error
+	// stdout may carry the protocol
+	s.d, err = dbg.DebugAndroid(args, os.Stderr)
+	if err != nil {
+		s.replyErr(req, launchErr, err.Error(), true)
+		return
+	}
+	s.reply(newEvent("initialized", nil))
+	s.reply(newResponse(req, nil))
+}
+
 type breakpoint struct {
 	ID       int    `json:"id,omitempty"`
 	Verified bool   `json:"verified"`
@@ -158,11 +225,20 @@ func (s *Session) setExceptionBreakpoints(req *request) {
 	s.reply(newResponse(req, nil)) // just ignore
 }
 
+// mainThread is the thread id reported when the debugger doesn't tell.
+const mainThread = 1
+
 func (s *Session) onThreads(req *request) {
+	s.mu.Lock()
+	id := s.thread
+	s.mu.Unlock()
+	if id == 0 {
+		id = mainThread
+	}
 	resp := map[string]any{
 		"threads": []map[string]any{
 			{
-				"id":   1,
+				"id":   id,
 				"name": "main",
 			},
 		},
@@ -171,6 +247,18 @@ func (s *Session) onThreads(req *request) {
 }
 
 func (s *Session) onPause(req *request) {
+	if i, ok := s.d.(dbg.Interrupter); ok {
+		running, err := i.Interrupt()
+		if err != nil {
+			s.replyErr(req, pauseErr, err.Error(), true)
+			return
+		}
+		if running {
+			// the continue goroutine reports the stop
+			s.reply(newResponse(req, nil))
+			return
+		}
+	}
 	s.reply(newResponse(req, nil))
 	s.reply(newEvent("stopped", map[string]any{
 		"reason":            "pause",
@@ -179,6 +267,66 @@ func (s *Session) onPause(req *request) {
 	}))
 }
 
+func (s *Session) onContinue(req *request) {
+	if s.d == nil {
+		s.replyErr(req, continueErr, "debugger not running", true)
+		return
+	}
+	s.reply(newResponse(req, map[string]any{"allThreadsContinued": true}))
+	// The debugger serializes the requests handled meanwhile, stopping
+	// the program for them. Continue then returns with that stop, reported
+	// as a pause.
+	go func() {
+		if err := s.d.Continue(); err != nil {
+			s.reply(newEvent("output", map[string]any{"category": "stderr", "output": err.Error() + "\n"}))
+			s.reply(newEvent("terminated", nil))
+			return
+		}
+		stop := dbg.Stop{Reason: "breakpoint"}
+		if r, ok := s.d.(dbg.StopReporter); ok {
+			stop = r.LastStop()
+		}
+		if stop.ThreadID == 0 {
+			stop.ThreadID = mainThread
+		}
+		s.mu.Lock()
+		s.thread = stop.ThreadID
+		s.mu.Unlock()
+		s.reply(newEvent("stopped", stoppedBody(stop)))
+	}()
+}
+
+// Signal numbers of Linux, which lldb-server reports.
+const (
+	sigINT  = 2
+	sigTRAP = 5
+	sigSTOP = 19
+)
+
+// stoppedBody returns the body of the stopped event for stop.
+func stoppedBody(stop dbg.Stop) map[string]any {
+	body := map[string]any{"allThreadsStopped": true}
+	switch {
+	case stop.Reason == "breakpoint":
+		body["reason"] = "breakpoint"
+	case stop.Reason == "trace":
+		body["reason"] = "step"
+	case stop.Reason == "watchpoint":
+		body["reason"] = "data breakpoint"
+	case stop.Signal == sigTRAP && stop.Reason == "":
+		body["reason"] = "breakpoint"
+	case stop.Signal == sigINT || stop.Signal == sigSTOP:
+		body["reason"] = "pause"
+	default:
+		body["reason"] = "exception"
+		if stop.Signal != 0 {
+			body["description"] = fmt.Sprintf("signal %d", stop.Signal)
+		}
+	}
+	body["threadId"] = stop.ThreadID
+	return body
+}
+
 func (s *Session) onStackTrace(req *request) {
 	resp := map[string]any{
 		"stackFrames": []map[string]any{
@@ -222,6 +370,8 @@ func (s *Session) onVariables(req *request) {
 }
 
 func (s *Session) reply(m message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if err := writeMessage(s.rw, m); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	}
@@ -235,6 +385,8 @@ func (s *Session) replyErr(incoming message, e gniDAPError, details string, show
 	}
 
 	resp := newErrResponse(incoming, int(e), cmd, e.String(), details, show)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if err := writeMessage(s.rw, resp); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	}
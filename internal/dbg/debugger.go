@@ -1,5 +1,10 @@
 package dbg
 
+import (
+	"errors"
+	"io"
+)
+
 const (
 	ArchAMD64 = "amd64"
 	ArchARM64 = "arm64"
@@ -12,6 +17,31 @@ type Breakpoint struct {
 	Line int
 }
 
+// Stop tells why the program stopped.
+type Stop struct {
+	// Reason is the reason reported by the debug server: breakpoint,
+	// trace, watchpoint, signal, exception, or empty if unknown.
+	Reason string
+	// Signal is the number of the signal stopping the program.
+	Signal int
+	// ThreadID is the thread that stopped, 0 if unknown.
+	ThreadID int
+}
+
+// StopReporter is implemented by debuggers telling why the program last
+// stopped.
+type StopReporter interface {
+	LastStop() Stop
+}
+
+// Interrupter is implemented by debuggers able to stop the program while
+// Continue runs.
+type Interrupter interface {
+	// Interrupt stops the running program, making Continue return. It
+	// reports whether the program was running.
+	Interrupt() (bool, error)
+}
+
 type Debugger interface {
 	// Run the program with the given arguments.
 	Run(program string, args []string) error
@@ -22,3 +52,16 @@ type Debugger interface {
 	// Continue execution.
 	Continue() error
 }
+
+// Android builds, launches and attaches to the app on an Android device as
+// requested by the command line args, writing progress to out. It is set by
+// the package handling devices, which depends on this one.
+var Android func(args []string, out io.Writer) (Debugger, error)
+
+// DebugAndroid calls Android.
+func DebugAndroid(args []string, out io.Writer) (Debugger, error) {
+	if Android == nil {
+		return nil, errors.New("android debugging is not available")
+	}
+	return Android(args, out)
+}
@@ -37,7 +37,12 @@ type conn struct {
 	packetSize int
 }
 
+// stopPacket is a stop reply: S or T followed by the signal number, and
+// for T a list of key:value pairs.
 type stopPacket struct {
+	signal int
+	thread int
+	reason string
 }
 
 type processInfo struct {
@@ -170,15 +175,62 @@ func (c *conn) removeBreakpoint(addr uint64, kind int) error {
 	return err
 }
 
+func (c *conn) detach() error {
+	_, err := c.exec("D")
+	return err
+}
+
+// interrupt stops the running process, which then sends the stop reply
+// of the packet resuming it.
+func (c *conn) interrupt() error {
+	_, err := c.remote.Write([]byte{0x03})
+	return err
+}
+
 func (c *conn) stopReply(resp []byte) (stopPacket, error) {
 	switch resp[0] {
-	case 'T':
-		return stopPacket{}, nil
+	case 'T', 'S':
+		return parseStopPacket(resp)
+	case 'W', 'X':
+		return stopPacket{}, fmt.Errorf("process exited: %s", resp)
 	default:
 		return stopPacket{}, fmt.Errorf("unknown stop reply: %s", resp)
 	}
 }
 
+func parseStopPacket(resp []byte) (stopPacket, error) {
+	if len(resp) < 3 {
+		return stopPacket{}, fmt.Errorf("invalid stop reply: %s", resp)
+	}
+	sig, err := strconv.ParseUint(string(resp[1:3]), 16, 8)
+	if err != nil {
+		return stopPacket{}, fmt.Errorf("invalid stop reply: %s", resp)
+	}
+	p := stopPacket{signal: int(sig)}
+	if resp[0] == 'S' {
+		return p, nil
+	}
+	for _, kv := range strings.Split(string(resp[3:]), ";") {
+		k, v, ok := strings.Cut(kv, ":")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "thread":
+			// p<pid>.<tid> with the multiprocess extension
+			if i := strings.IndexByte(v, '.'); i >= 0 {
+				v = v[i+1:]
+			}
+			if tid, err := strconv.ParseInt(v, 16, 64); err == nil {
+				p.thread = int(tid)
+			}
+		case "reason":
+			p.reason = v
+		}
+	}
+	return p, nil
+}
+
 func (c *conn) exec(cmd string) ([]byte, error) {
 	if err := c.send(cmd); err != nil {
 		return nil, err
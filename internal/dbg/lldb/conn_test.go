@@ -87,3 +87,29 @@ func TestConnSend(t *testing.T) {
 		}
 	}
 }
+
+var stopTests = []struct {
+	resp    string
+	want    stopPacket
+	wantErr bool
+}{
+	{resp: "S05", want: stopPacket{signal: 5}},
+	{resp: "T05thread:1f3a;name:app;reason:breakpoint;", want: stopPacket{signal: 5, thread: 0x1f3a, reason: "breakpoint"}},
+	{resp: "T13thread:p1f00.1f3b;reason:signal;", want: stopPacket{signal: 0x13, thread: 0x1f3b, reason: "signal"}},
+	{resp: "T0bthread:2a;00:0000000000000000;", want: stopPacket{signal: 0xb, thread: 0x2a}},
+	{resp: "W00", wantErr: true},
+	{resp: "T", wantErr: true},
+}
+
+func TestStopReply(t *testing.T) {
+	c := &conn{}
+	for i, test := range stopTests {
+		got, err := c.stopReply([]byte(test.resp))
+		if test.wantErr {
+			assert.Error(t, err, "test #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "test #%d", i)
+		assert.Equal(t, test.want, got, "test #%d", i)
+	}
+}
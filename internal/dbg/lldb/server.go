@@ -9,6 +9,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -22,10 +23,29 @@ type LLDB struct {
 	c          *conn
 	connCloser io.Closer
 	sym        proc.SymTable
+	bias       uint64
 	arch       string
 	bpKind     int
 	bpCnt      int
 	bps        map[int]*dbg.Breakpoint
+
+	// mu serializes the use of the connection and of the fields above.
+	// Continue holds it while the program runs, the other methods stop the
+	// program to get it, as no other packet may be sent until the stop
+	// reply.
+	mu sync.Mutex
+	// stateMu guards the fields below and the writes of interrupts.
+	stateMu sync.Mutex
+	// continuing is the number of Continue calls in progress, running is
+	// set between the c packet and its stop reply.
+	continuing int
+	running    bool
+	// pending is the number of callers waiting for mu, wantStop is set
+	// by Interrupt; both stop the program as soon as it runs.
+	pending     int
+	wantStop    bool
+	interrupted bool
+	stop        stopPacket
 }
 
 func LaunchServer() (dbg.Debugger, error) {
@@ -64,13 +84,69 @@ func LaunchServer() (dbg.Debugger, error) {
 		tmpDir:     tmp,
 		c:          lldbConn,
 		connCloser: conn,
+		bps:        make(map[int]*dbg.Breakpoint),
 	}, nil
 }
 
+// Connect timing: a port forwarded by adb accepts connections before the
+// server listens, so connecting is retried every connectRetry until
+// connectTimeout has passed.
+var (
+	connectRetry   = 100 * time.Millisecond
+	connectTimeout = 5 * time.Second
+)
+
+// Connect connects to an lldb-server in gdbserver mode already attached to
+// a process. It returns the last dial or handshake error if the server
+// doesn't answer in time.
+func Connect(network, address string) (*LLDB, error) {
+	deadline := time.Now().Add(connectTimeout)
+	for {
+		l, err := connect(network, address, deadline)
+		if err == nil {
+			return l, nil
+		}
+		if time.Now().Add(connectRetry).After(deadline) {
+			return nil, fmt.Errorf("lldb-server at %s didn't answer: %w", address, err)
+		}
+		time.Sleep(connectRetry)
+	}
+}
+
+// connect makes a single attempt of Connect, bounded by deadline.
+func connect(network, address string, deadline time.Time) (*LLDB, error) {
+	d := net.Dialer{Deadline: deadline}
+	conn, err := d.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	lldbConn := newConn(conn)
+	conn.SetDeadline(deadline)
+	if err := lldbConn.handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	l := &LLDB{
+		c:          lldbConn,
+		connCloser: conn,
+		bps:        make(map[int]*dbg.Breakpoint),
+	}
+	if err := l.fetchFutures(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
 func (l *LLDB) Run(program string, args []string) error {
-	if _, err := l.c.run(program, args); err != nil {
+	l.lock()
+	defer l.mu.Unlock()
+	stop, err := l.c.run(program, args)
+	if err != nil {
 		return err
 	}
+	l.setStop(stop)
 	if err := l.fetchFutures(); err != nil {
 		return err
 	}
@@ -85,6 +161,47 @@ func (l *LLDB) Run(program string, args []string) error {
 	return l.readImage(pi.name)
 }
 
+// LoadSymbols loads the debug information of a local copy of the image
+// loaded at bias from its link-time addresses.
+func (l *LLDB) LoadSymbols(filename string, bias uint64) error {
+	l.lock()
+	defer l.mu.Unlock()
+	elfFile, err := elf.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer elfFile.Close()
+
+	dwarf, err := elfFile.DWARF()
+	if err != nil {
+		return err
+	}
+	l.bias = bias
+	return l.sym.LoadImage(dwarf)
+}
+
+// PassSignals makes the server deliver the signals to the process without
+// stopping it.
+func (l *LLDB) PassSignals(signals ...syscall.Signal) error {
+	l.lock()
+	defer l.mu.Unlock()
+	hex := make([]string, len(signals))
+	for i, sig := range signals {
+		hex[i] = fmt.Sprintf("%x", int(sig))
+	}
+	_, err := l.c.exec("QPassSignals:" + strings.Join(hex, ";"))
+	return err
+}
+
+// Release detaches the server from the process, leaving it running.
+func (l *LLDB) Release() error {
+	l.lock()
+	defer l.mu.Unlock()
+	return l.c.detach()
+}
+
+// Detach closes the connection to the server. It doesn't wait for mu, so
+// that it also ends a Continue waiting for a server that went away.
 func (l *LLDB) Detach() error {
 	if err := l.connCloser.Close(); err != nil {
 		return err
@@ -93,11 +210,13 @@ func (l *LLDB) Detach() error {
 }
 
 func (l *LLDB) SetBreakpoint(bp *dbg.Breakpoint) (*dbg.Breakpoint, error) {
+	l.lock()
+	defer l.mu.Unlock()
 	addr, filePath, err := l.sym.LineToPC(bp.File, bp.Line)
 	if err != nil {
 		return nil, err
 	}
-	if err := l.c.insertBreakpoint(addr, l.bpKind); err != nil {
+	if err := l.c.insertBreakpoint(addr+l.bias, l.bpKind); err != nil {
 		return nil, err
 	}
 	l.bpCnt++
@@ -111,9 +230,96 @@ func (l *LLDB) SetBreakpoint(bp *dbg.Breakpoint) (*dbg.Breakpoint, error) {
 	return newBp, nil
 }
 
+// Continue resumes the program and waits for it to stop. The other
+// methods, and Interrupt, stop it early.
 func (l *LLDB) Continue() error {
-	_, err := l.c.exec("c")
-	return err
+	l.stateMu.Lock()
+	l.continuing++
+	l.stateMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stateMu.Lock()
+	l.continuing--
+	err := l.c.send("c")
+	if err == nil {
+		l.running = true
+		if l.pending > 0 || l.wantStop {
+			// the error shows up when reading the stop reply
+			l.interrupt()
+		}
+	}
+	l.stateMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	resp, err := l.c.recv("c")
+	var stop stopPacket
+	if err == nil {
+		stop, err = l.c.stopReply(resp)
+	}
+	l.stateMu.Lock()
+	l.running, l.interrupted, l.wantStop = false, false, false
+	l.stateMu.Unlock()
+	if err != nil {
+		return err
+	}
+	l.setStop(stop)
+	return nil
+}
+
+// Interrupt stops the program resumed by Continue, which then returns.
+// It reports whether the program was running or about to run.
+func (l *LLDB) Interrupt() (bool, error) {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	if l.running {
+		return true, l.interrupt()
+	}
+	if l.continuing > 0 {
+		l.wantStop = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// lock locks mu, stopping the program if it runs.
+func (l *LLDB) lock() {
+	l.stateMu.Lock()
+	l.pending++
+	if l.running {
+		l.interrupt()
+	}
+	l.stateMu.Unlock()
+
+	l.mu.Lock()
+	l.stateMu.Lock()
+	l.pending--
+	l.stateMu.Unlock()
+}
+
+// interrupt sends an interrupt to the running program, once per run.
+// stateMu must be held.
+func (l *LLDB) interrupt() error {
+	if l.interrupted {
+		return nil
+	}
+	l.interrupted = true
+	return l.c.interrupt()
+}
+
+func (l *LLDB) setStop(stop stopPacket) {
+	l.stateMu.Lock()
+	l.stop = stop
+	l.stateMu.Unlock()
+}
+
+// LastStop tells why the process last stopped.
+func (l *LLDB) LastStop() dbg.Stop {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	return dbg.Stop{Reason: l.stop.reason, Signal: l.stop.signal, ThreadID: l.stop.thread}
 }
 
 func (l *LLDB) readImage(filename string) error {
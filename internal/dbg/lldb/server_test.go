@@ -0,0 +1,111 @@
+package lldb
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gni.dev/cmd/internal/dbg"
+)
+
+func TestConnectTimeout(t *testing.T) {
+	defer func(d time.Duration) { connectTimeout = d }(connectTimeout)
+	connectTimeout = 500 * time.Millisecond
+
+	// A stale adb forward accepts connections and closes them.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	start := time.Now()
+	_, err = Connect("tcp", l.Addr().String())
+	assert.ErrorContains(t, err, "didn't answer")
+	assert.Less(t, time.Since(start), 2*connectTimeout)
+}
+
+// fakeServer reads the packets of an LLDB over a pipe. An interrupt is
+// read as "\x03".
+type fakeServer struct {
+	t *testing.T
+	c net.Conn
+	r *bufio.Reader
+}
+
+func newFakeServer(t *testing.T) (*LLDB, *fakeServer) {
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close(); server.Close() })
+	l := &LLDB{c: newConn(client), connCloser: client, bps: make(map[int]*dbg.Breakpoint)}
+	return l, &fakeServer{t: t, c: server, r: bufio.NewReader(server)}
+}
+
+func (s *fakeServer) read() string {
+	b, err := s.r.ReadByte()
+	require.NoError(s.t, err)
+	if b == 0x03 {
+		return "\x03"
+	}
+	p, err := s.r.ReadString('#')
+	require.NoError(s.t, err)
+	_, err = s.r.Discard(2)
+	require.NoError(s.t, err)
+	return p[:len(p)-1]
+}
+
+func (s *fakeServer) write(p string) {
+	_, err := fmt.Fprintf(s.c, "$%s#%02x", p, checksum([]byte(p)))
+	require.NoError(s.t, err)
+}
+
+func TestRequestWhileRunning(t *testing.T) {
+	l, s := newFakeServer(t)
+	cont := make(chan error, 1)
+	go func() { cont <- l.Continue() }()
+	assert.Equal(t, "c", s.read())
+
+	pass := make(chan error, 1)
+	go func() { pass <- l.PassSignals(0x12) }()
+	// the program is stopped before any other packet
+	assert.Equal(t, "\x03", s.read())
+	s.write("T13thread:p1f.20;")
+	assert.NoError(t, <-cont)
+	assert.Equal(t, dbg.Stop{Signal: 0x13, ThreadID: 0x20}, l.LastStop())
+
+	assert.Equal(t, "QPassSignals:12", s.read())
+	s.write("OK")
+	assert.NoError(t, <-pass)
+}
+
+func TestInterrupt(t *testing.T) {
+	l, s := newFakeServer(t)
+	running, err := l.Interrupt()
+	assert.NoError(t, err)
+	assert.False(t, running)
+
+	cont := make(chan error, 1)
+	go func() { cont <- l.Continue() }()
+	assert.Equal(t, "c", s.read())
+	interrupted := make(chan bool, 1)
+	go func() {
+		running, err := l.Interrupt()
+		assert.NoError(t, err)
+		interrupted <- running
+	}()
+	assert.Equal(t, "\x03", s.read())
+	assert.True(t, <-interrupted)
+	s.write("T02thread:1;")
+	assert.NoError(t, <-cont)
+	assert.Equal(t, dbg.Stop{Signal: 2, ThreadID: 1}, l.LastStop())
+}
@@ -4,6 +4,7 @@ import (
 	"debug/dwarf"
 	"io"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -12,6 +13,7 @@ type compileUnit struct {
 
 	files []*fileInfo
 	funcs []*Func
+	lines []lineEntry
 }
 
 type fileInfo struct {
@@ -19,6 +21,14 @@ type fileInfo struct {
 	lines map[int]uint64
 }
 
+// lineEntry maps the instructions starting at addr to a source line. An
+// entry with a nil file ends a sequence of instructions.
+type lineEntry struct {
+	addr uint64
+	file *fileInfo
+	line int
+}
+
 func newCompileUnit() *compileUnit {
 	return &compileUnit{}
 }
@@ -28,6 +38,9 @@ func (cu *compileUnit) loadLines(d *dwarf.Data, e *dwarf.Entry) error {
 	if err != nil {
 		return err
 	}
+	if r == nil {
+		return nil
+	}
 
 	files := make(map[string]*fileInfo)
 
@@ -41,21 +54,61 @@ func (cu *compileUnit) loadLines(d *dwarf.Data, e *dwarf.Entry) error {
 			return err
 		}
 
+		if l.EndSequence {
+			cu.lines = append(cu.lines, lineEntry{addr: l.Address})
+			continue
+		}
+
 		f, ok := files[l.File.Name]
 		if ok {
 			f.lines[l.Line] = l.Address
 		} else {
-			files[l.File.Name] = &fileInfo{
+			f = &fileInfo{
 				name: l.File.Name,
 				lines: map[int]uint64{
 					l.Line: l.Address,
 				},
 			}
+			files[l.File.Name] = f
 		}
+		cu.lines = append(cu.lines, lineEntry{addr: l.Address, file: f, line: l.Line})
 	}
 	for _, f := range files {
 		cu.files = append(cu.files, f)
 	}
+	sortLines(cu.lines)
+	return nil
+}
+
+// sortLines sorts lines by address. A sequence may start where another
+// ends, so the end entry goes first at the same address.
+func sortLines(lines []lineEntry) {
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].addr != lines[j].addr {
+			return lines[i].addr < lines[j].addr
+		}
+		return lines[i].file == nil && lines[j].file != nil
+	})
+}
+
+// pcToLine returns the line entry covering pc.
+func (cu *compileUnit) pcToLine(pc uint64) (lineEntry, bool) {
+	i := sort.Search(len(cu.lines), func(i int) bool {
+		return cu.lines[i].addr > pc
+	})
+	if i == 0 || cu.lines[i-1].file == nil {
+		return lineEntry{}, false
+	}
+	return cu.lines[i-1], true
+}
+
+// pcToFunc returns the function containing pc.
+func (cu *compileUnit) pcToFunc(pc uint64) *Func {
+	for _, f := range cu.funcs {
+		if pc >= f.lowpc && pc < f.highpc {
+			return f
+		}
+	}
 	return nil
 }
 
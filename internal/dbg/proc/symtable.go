@@ -102,3 +102,16 @@ func (s *SymTable) LineToPC(file string, line int) (uint64, string, error) {
 	}
 	return 0, "", fmt.Errorf("location %s:%d not found", file, line)
 }
+
+// PCToLine returns the file, line and function for the given PC.
+func (s *SymTable) PCToLine(pc uint64) (string, int, *Func, error) {
+	for _, r := range s.cuRanges {
+		if pc < r.lowpc || pc >= r.highpc {
+			continue
+		}
+		if l, ok := r.cu.pcToLine(pc); ok {
+			return l.file.name, l.line, r.cu.pcToFunc(pc), nil
+		}
+	}
+	return "", 0, nil, fmt.Errorf("pc %#x not found", pc)
+}
@@ -39,3 +39,62 @@ func TestSymbols(t *testing.T) {
 	var errAmbiguous *ErrAmbiguous
 	assert.ErrorAs(t, err, &errAmbiguous)
 }
+
+func TestPCToLine(t *testing.T) {
+	fixt := test.Build("symbols")
+	var sym SymTable
+
+	elfFile, err := elf.Open(fixt)
+	assert.NoError(t, err)
+	defer elfFile.Close()
+
+	dwarf, err := elfFile.DWARF()
+	assert.NoError(t, err)
+
+	assert.NoError(t, sym.LoadImage(dwarf))
+
+	pc, file, err := sym.LineToPC("symbols.go", 33)
+	assert.NoError(t, err)
+
+	gotFile, gotLine, fn, err := sym.PCToLine(pc)
+	assert.NoError(t, err)
+	assert.Equal(t, file, gotFile)
+	assert.Equal(t, 33, gotLine)
+	if assert.NotNil(t, fn) {
+		assert.Equal(t, "main.main", fn.Name())
+	}
+}
+
+func TestPCToLineAdjacentSequences(t *testing.T) {
+	a := &fileInfo{name: "a.go"}
+	b := &fileInfo{name: "b.go"}
+	// the sequence of b.go starts where the one of a.go ends, the entries
+	// being in the order of the line programs
+	cu := &compileUnit{lines: []lineEntry{
+		{addr: 0x1000, file: b, line: 1},
+		{addr: 0x1010, file: b, line: 2},
+		{addr: 0x1020},
+		{addr: 0x0f00, file: a, line: 10},
+		{addr: 0x1000},
+	}}
+	sortLines(cu.lines)
+
+	tests := []struct {
+		pc   uint64
+		file *fileInfo
+		line int
+	}{
+		{pc: 0x0eff},
+		{pc: 0x0f00, file: a, line: 10},
+		{pc: 0x0fff, file: a, line: 10},
+		{pc: 0x1000, file: b, line: 1},
+		{pc: 0x1018, file: b, line: 2},
+		{pc: 0x1020},
+	}
+	for _, test := range tests {
+		l, ok := cu.pcToLine(test.pc)
+		assert.Equal(t, test.file != nil, ok, "%#x", test.pc)
+		assert.Equal(t, test.file, l.file, "%#x", test.pc)
+		assert.Equal(t, test.line, l.line, "%#x", test.pc)
+	}
+}
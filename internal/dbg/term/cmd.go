@@ -1,8 +1,10 @@
 package term
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 
 	"gni.dev/cmd/internal/dbg"
@@ -17,6 +19,8 @@ type command struct {
 type Commands struct {
 	cmds []command
 	d    dbg.Debugger
+	out  io.Writer
+	in   *input
 }
 
 func DebuggerCommands() *Commands {
@@ -30,6 +34,14 @@ func DebuggerCommands() *Commands {
 			aliases: []string{"run", "r"},
 			fn:      c.run,
 		},
+		command{
+			aliases: []string{"break", "b"},
+			fn:      c.breakpoint,
+		},
+		command{
+			aliases: []string{"continue", "c"},
+			fn:      c.cont,
+		},
 	)
 	return c
 }
@@ -51,6 +63,9 @@ func (c *Commands) Process(line string) error {
 }
 
 func (c *Commands) Close() error {
+	if c.d == nil {
+		return nil
+	}
 	return c.d.Detach()
 }
 
@@ -69,3 +84,65 @@ func (c *Commands) run(args []string) error {
 	}
 	return c.d.Run(args[0], args[1:])
 }
+
+func (c *Commands) breakpoint(args []string) error {
+	if c.d == nil {
+		return fmt.Errorf("debugger not running")
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: break <file>:<line>")
+	}
+	i := strings.LastIndex(args[0], ":")
+	if i <= 0 {
+		return fmt.Errorf("invalid location '%s', want <file>:<line>", args[0])
+	}
+	line, err := strconv.Atoi(args[0][i+1:])
+	if err != nil {
+		return fmt.Errorf("invalid line in '%s'", args[0])
+	}
+	bp, err := c.d.SetBreakpoint(&dbg.Breakpoint{File: args[0][:i], Line: line})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Breakpoint %d at %s:%d\r\n", bp.ID, bp.File, bp.Line)
+	return nil
+}
+
+// cont resumes the program until it stops. Ctrl-C interrupts it, other
+// input is discarded meanwhile.
+func (c *Commands) cont(args []string) error {
+	if c.d == nil {
+		return fmt.Errorf("debugger not running")
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- c.d.Continue()
+	}()
+	var keys <-chan []byte
+	if c.in != nil {
+		keys = c.in.ch
+	}
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(c.out, "Stopped\r\n")
+			return nil
+		case b, ok := <-keys:
+			if !ok {
+				keys = nil
+				continue
+			}
+			if bytes.IndexByte(b, keyCtrlC) < 0 {
+				continue
+			}
+			if i, ok := c.d.(dbg.Interrupter); ok {
+				if _, err := i.Interrupt(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
@@ -5,9 +5,16 @@ import (
 	"fmt"
 	"io"
 	"os"
+
+	"gni.dev/cmd/internal/dbg"
 )
 
 func Run(args []string) {
+	if len(args) > 0 && args[0] == "android" {
+		runAndroid(args[1:])
+		return
+	}
+
 	var argInit string
 	dbgFlags := flag.NewFlagSet("debug", flag.ExitOnError)
 	dbgFlags.StringVar(&argInit, "init", "", "initial command to run")
@@ -43,3 +50,26 @@ func setRawTerminal() *State {
 	}
 	return st
 }
+
+// runAndroid debugs the app on an Android device.
+func runAndroid(args []string) {
+	d, err := dbg.DebugAndroid(args, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	st := setRawTerminal()
+	defer st.Restore()
+
+	screen := struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}
+	t := New(screen, "(gni) ")
+	t.Attach(d)
+	if err := t.Run(""); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"strings"
+
+	"gni.dev/cmd/internal/dbg"
 )
 
 const (
@@ -35,6 +37,7 @@ type Term struct {
 	prompt      string
 	line        string
 	cmd         *Commands
+	in          *input
 	r           *bufio.Reader
 	history     *list.List
 	historyCurr *list.Element
@@ -47,13 +50,21 @@ func New(rw io.ReadWriter, prompt string) *Term {
 		rw:      rw,
 		prompt:  prompt,
 		cmd:     DebuggerCommands(),
-		r:       bufio.NewReaderSize(rw, 256),
+		in:      newInput(rw),
 		history: list.New(),
 	}
+	t.r = bufio.NewReaderSize(t.in, 256)
 	t.historyCurr = t.history.PushBack("") // dummy element
+	t.cmd.out = rw
+	t.cmd.in = t.in
 	return t
 }
 
+// Attach makes the commands use a debugger already attached to a program.
+func (t *Term) Attach(d dbg.Debugger) {
+	t.cmd.d = d
+}
+
 func (t *Term) Run(initCmd string) error {
 	if initCmd != "" {
 		if err := t.cmd.Process(initCmd); err != nil {
@@ -68,7 +79,7 @@ func (t *Term) Run(initCmd string) error {
 		}
 		if err != nil {
 			t.writeString(fmt.Sprintf("%sError reading line: %s%s\n", escRed, err, escReset))
-			t.r.Reset(t.rw)
+			t.r.Reset(t.in)
 			continue
 		}
 
@@ -86,6 +97,46 @@ func (t *Term) Run(initCmd string) error {
 	return t.cmd.Close()
 }
 
+// input reads the terminal in the background, so that commands can watch
+// for Ctrl-C while they run.
+type input struct {
+	ch  chan []byte
+	err error // set before ch is closed
+	buf []byte
+}
+
+func newInput(r io.Reader) *input {
+	in := &input{ch: make(chan []byte)}
+	go func() {
+		for {
+			b := make([]byte, 256)
+			n, err := r.Read(b)
+			if n > 0 {
+				in.ch <- b[:n]
+			}
+			if err != nil {
+				in.err = err
+				close(in.ch)
+				return
+			}
+		}
+	}()
+	return in
+}
+
+func (in *input) Read(p []byte) (int, error) {
+	if len(in.buf) == 0 {
+		b, ok := <-in.ch
+		if !ok {
+			return 0, in.err
+		}
+		in.buf = b
+	}
+	n := copy(p, in.buf)
+	in.buf = in.buf[n:]
+	return n, nil
+}
+
 func (t *Term) handleEscape() error {
 	var seq []byte
 	for {
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"gni.dev/cmd/internal/dbg"
 )
 
 type MockTerminal struct {
@@ -103,3 +104,56 @@ func TestRender(t *testing.T) {
 		}
 	}
 }
+
+type mockDebugger struct {
+	bps       []*dbg.Breakpoint
+	continued int
+}
+
+func (d *mockDebugger) Run(program string, args []string) error { return nil }
+func (d *mockDebugger) Detach() error                           { return nil }
+func (d *mockDebugger) Continue() error                         { d.continued++; return nil }
+
+func (d *mockDebugger) SetBreakpoint(bp *dbg.Breakpoint) (*dbg.Breakpoint, error) {
+	d.bps = append(d.bps, bp)
+	return &dbg.Breakpoint{ID: len(d.bps), File: "/src/app/" + bp.File, Line: bp.Line}, nil
+}
+
+func TestBreakContinue(t *testing.T) {
+	screen := NewMockTerminal("", 1)
+	tt := New(screen, "> ")
+	d := &mockDebugger{}
+	tt.Attach(d)
+
+	assert.NoError(t, tt.cmd.Process("b main.go:12"))
+	assert.NoError(t, tt.cmd.Process("continue"))
+	assert.ErrorContains(t, tt.cmd.Process("break main.go"), "invalid location")
+	assert.Equal(t, []*dbg.Breakpoint{{File: "main.go", Line: 12}}, d.bps)
+	assert.Equal(t, 1, d.continued)
+	assert.Equal(t, "Breakpoint 1 at /src/app/main.go:12\r\nStopped\r\n", screen.output.String())
+}
+
+// runningDebugger is a debugger whose Continue runs until interrupted.
+type runningDebugger struct {
+	mockDebugger
+	stop chan struct{}
+}
+
+func (d *runningDebugger) Continue() error {
+	<-d.stop
+	return nil
+}
+
+func (d *runningDebugger) Interrupt() (bool, error) {
+	close(d.stop)
+	return true, nil
+}
+
+func TestContinueInterrupt(t *testing.T) {
+	screen := NewMockTerminal("ls\x03", 1)
+	tt := New(screen, "> ")
+	tt.Attach(&runningDebugger{stop: make(chan struct{})})
+
+	assert.NoError(t, tt.cmd.Process("c"))
+	assert.Equal(t, "Stopped\r\n", screen.output.String())
+}
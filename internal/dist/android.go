@@ -0,0 +1,132 @@
+package dist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gni.dev/cmd/internal/build"
+)
+
+const checksumsFile = "SHA256SUMS"
+
+// packageAndroid assembles the release artifacts of an Android build into a
+// versioned directory and returns its path.
+func packageAndroid(m build.Metadata, a *build.Args) (string, error) {
+	name := a.ArtifactName(m)
+	dir := filepath.Join(a.OutDir(), "dist", fmt.Sprintf("%s-%s+%d", name, m.Version, m.Build))
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	apk := fmt.Sprintf("%s-%s.apk", name, m.Version)
+	if err := copyFile(a.APK(m), filepath.Join(dir, apk)); err != nil {
+		return "", err
+	}
+
+	libs, err := build.UnstrippedLibs(a)
+	if err != nil {
+		return "", err
+	}
+	abis := make([]string, 0, len(libs))
+	for abi, lib := range libs {
+		if err := copyFile(lib, filepath.Join(dir, "symbols", abi, "libgni.so")); err != nil {
+			return "", err
+		}
+		abis = append(abis, abi)
+	}
+	if len(abis) == 0 {
+		return "", fmt.Errorf("no native libraries found in %s", a.BuildDir())
+	}
+
+	// All ABIs are built from the same module graph.
+	sort.Strings(abis)
+	sbom, err := newSBOM(m, libs[abis[0]])
+	if err != nil {
+		return "", err
+	}
+	if err := writeJSON(filepath.Join(dir, "sbom.spdx.json"), sbom); err != nil {
+		return "", err
+	}
+	if err := writeJSON(filepath.Join(dir, "metadata.json"), m); err != nil {
+		return "", err
+	}
+	return dir, writeChecksums(dir)
+}
+
+// writeChecksums writes the SHA-256 sums of all files in dir in the format
+// read by sha256sum -c.
+func writeChecksums(dir string) error {
+	var sums strings.Builder
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() == checksumsFile {
+			return nil
+		}
+		sum, err := sha256File(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&sums, "%s  %s\n", sum, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, checksumsFile), []byte(sums.String()), 0644)
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
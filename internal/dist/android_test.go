@@ -0,0 +1,184 @@
+package dist
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gni.dev/cmd/internal/build"
+)
+
+// testBuildID is the GNU build-id of the library built by buildLib.
+const testBuildID = "0123456789abcdef"
+
+// buildLib builds a program standing for libgni.so, with build info and a
+// GNU build-id.
+func buildLib(t *testing.T) string {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs an ELF toolchain")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n\ngo 1.18\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+	lib := filepath.Join(dir, "libgni.so")
+	cmd := exec.Command("go", "build", "-o", lib, "-ldflags=-B 0x"+testBuildID)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return lib
+}
+
+// readChecksums returns the files and sums listed in the SHA256SUMS of dir.
+func readChecksums(t *testing.T, dir string) map[string]string {
+	f, err := os.Open(filepath.Join(dir, checksumsFile))
+	require.NoError(t, err)
+	defer f.Close()
+	sums := make(map[string]string)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		sum, name, ok := strings.Cut(s.Text(), "  ")
+		require.True(t, ok, s.Text())
+		sums[name] = sum
+	}
+	require.NoError(t, s.Err())
+	return sums
+}
+
+func TestWriteChecksums(t *testing.T) {
+	tests := []struct {
+		files map[string]string
+		want  map[string]string
+	}{
+		{
+			files: map[string]string{},
+			want:  map[string]string{},
+		},
+		{
+			files: map[string]string{
+				"app.apk":             "apk",
+				"symbols/x86/lib.so":  "",
+				checksumsFile:         "stale",
+				"symbols/arm/lib.so":  "lib",
+				"metadata/empty.json": "{}",
+			},
+			want: map[string]string{
+				"app.apk":             "dd37c2d7274f7ea982cb83390c36918fee9ce8889073c44b68cdc00bdb8c3e04",
+				"symbols/x86/lib.so":  "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+				"symbols/arm/lib.so":  "76b5a357391276b282a516f54f48ef3c207f46d8192dc58c208d5183d38415f8",
+				"metadata/empty.json": "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+			},
+		},
+	}
+	for i, test := range tests {
+		dir := t.TempDir()
+		for name, data := range test.files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+			require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+		}
+		require.NoError(t, writeChecksums(dir), "test #%d", i)
+		assert.Equal(t, test.want, readChecksums(t, dir), "test #%d", i)
+	}
+}
+
+// releaseArgs returns the arguments of a release build to the output dir
+// out, of the variant if not empty.
+func releaseArgs(t *testing.T, out, variant string) *build.Args {
+	f := flag.NewFlagSet("package", flag.ContinueOnError)
+	a := build.CreateArgs(f)
+	args := []string{"-o", out}
+	if variant != "" {
+		args = append(args, "-variant", variant)
+	}
+	require.NoError(t, f.Parse(args))
+	return a
+}
+
+func TestPackageAndroid(t *testing.T) {
+	lib := buildLib(t)
+	bt := time.Unix(1700000000, 0).UTC()
+	m := build.Metadata{
+		AppID:     "com.example.app",
+		Name:      "Example App",
+		Package:   "example.com/app",
+		Version:   "1.2.0",
+		Build:     3,
+		BuildTime: &bt,
+	}
+	tests := []struct {
+		variant string
+		abis    []string
+		dir     string
+		want    []string
+		err     string
+	}{
+		{
+			abis: []string{"x86_64", "arm64-v8a"},
+			dir:  "app-1.2.0+3",
+			want: []string{
+				"app-1.2.0.apk",
+				"metadata.json",
+				"sbom.spdx.json",
+				"symbols/arm64-v8a/libgni.so",
+				"symbols/x86_64/libgni.so",
+			},
+		},
+		{
+			variant: "dev",
+			abis:    []string{"x86_64"},
+			dir:     "app-dev-1.2.0+3",
+			want: []string{
+				"app-dev-1.2.0.apk",
+				"metadata.json",
+				"sbom.spdx.json",
+				"symbols/x86_64/libgni.so",
+			},
+		},
+		{
+			err: "no native libraries found",
+		},
+	}
+	for i, test := range tests {
+		a := releaseArgs(t, t.TempDir(), test.variant)
+		for _, abi := range test.abis {
+			require.NoError(t, copyFile(lib, filepath.Join(a.BuildDir(), "lib", abi, "libgni.so")))
+		}
+		require.NoError(t, copyFile(lib, build.SymbolFile(a.SymbolsDir(), testBuildID)))
+		require.NoError(t, os.WriteFile(a.APK(m), []byte("apk"), 0o644))
+
+		dir, err := packageAndroid(m, a)
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, "test #%d", i)
+			continue
+		}
+		require.NoError(t, err, "test #%d", i)
+		assert.Equal(t, filepath.Join(a.OutDir(), "dist", test.dir), dir)
+
+		sums := readChecksums(t, dir)
+		var files []string
+		for name, sum := range sums {
+			got, err := sha256File(filepath.Join(dir, filepath.FromSlash(name)))
+			require.NoError(t, err)
+			assert.Equal(t, sum, got, name)
+			files = append(files, name)
+		}
+		sort.Strings(files)
+		assert.Equal(t, test.want, files, "test #%d", i)
+
+		data, err := os.ReadFile(filepath.Join(dir, "metadata.json"))
+		require.NoError(t, err)
+		var got build.Metadata
+		require.NoError(t, json.Unmarshal(data, &got))
+		assert.Equal(t, m, got, "test #%d", i)
+	}
+}
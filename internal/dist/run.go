@@ -0,0 +1,95 @@
+package dist
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gni.dev/cmd/internal/build"
+)
+
+func Run(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Please specify target (android)")
+		os.Exit(1)
+	}
+	target := args[0]
+
+	distFlags := flag.NewFlagSet("package", flag.ExitOnError)
+	a := build.CreateArgs(distFlags)
+	keystore := distFlags.String("keystore", "", "PKCS#12 keystore signing the release, as made by gni keygen. Default is keystore of "+build.ConfigFile+". Its password is read from $"+build.KeystorePasswordEnv)
+	if err := distFlags.Parse(args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if a.DebugBuild() {
+		fmt.Fprintln(os.Stderr, "Release packages can't be made from debug builds")
+		os.Exit(1)
+	}
+	if target != "android" {
+		fmt.Fprintln(os.Stderr, "Unknown target:", target)
+		os.Exit(1)
+	}
+
+	if a.Chdir() != "." {
+		if err := os.Chdir(a.Chdir()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if err := a.LoadConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// the password is not a flag, which would leave it in the shell
+	// history and the process list
+	if err := setKeystore(a, *keystore, os.Getenv(build.KeystorePasswordEnv)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	a.SetPatterns(distFlags.Args())
+	pkgs, err := a.MainPackages()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for _, pkg := range pkgs {
+		pa := a.WithPackage(pkg)
+		m, err := build.NewMetadata(pa)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Building package %s...\n", pkg)
+		if err := build.BuildAndroid(m, pa); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		dir, err := packageAndroid(m, pa)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Release package written to %s\n", dir)
+	}
+}
+
+// setKeystore makes a sign with the release keystore, checking it before
+// anything is built. Release packages signed with the debug key are
+// refused.
+func setKeystore(a *build.Args, keystore, password string) error {
+	if keystore == "" {
+		keystore = a.Config().Keystore
+	}
+	if keystore == "" {
+		return fmt.Errorf("release packages must be signed with a release key, use -keystore or set keystore in %s. Create one with gni keygen", build.ConfigFile)
+	}
+	if _, _, err := build.LoadKeystore(keystore, password); err != nil {
+		return err
+	}
+	a.SetKeystore(keystore, password)
+	return nil
+}
@@ -0,0 +1,70 @@
+package dist
+
+import (
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gni.dev/cmd/internal/build"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// writeKeystore writes a PKCS#12 keystore with the password to dir.
+func writeKeystore(t *testing.T, dir, name, password string) string {
+	key, err := build.GenerateKey("ec", 0)
+	require.NoError(t, err)
+	cert, err := build.NewCertificate(key, pkix.Name{CommonName: "Release"}, time.Now(), 1)
+	require.NoError(t, err)
+	pfx, err := pkcs12.Modern.Encode(key, cert, nil, password)
+	require.NoError(t, err)
+	ks := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(ks, pfx, 0o600))
+	return ks
+}
+
+func TestSetKeystore(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	writeKeystore(t, dir, "config.p12", "secret")
+	writeKeystore(t, dir, "flag.p12", "secret")
+	tests := []struct {
+		config   string
+		keystore string
+		password string
+		want     string
+		err      string
+	}{
+		{err: "must be signed with a release key"},
+		{config: "config.p12", password: "secret", want: "config.p12"},
+		{config: "config.p12", keystore: "flag.p12", password: "secret", want: "flag.p12"},
+		{keystore: "flag.p12", err: build.KeystorePasswordEnv},
+		{keystore: "flag.p12", password: "wrong", err: "failed to read keystore"},
+		{keystore: "missing.p12", password: "secret", err: "missing.p12"},
+	}
+	for i, test := range tests {
+		config := "{}"
+		if test.config != "" {
+			config = `{"keystore": "` + test.config + `"}`
+		}
+		require.NoError(t, os.WriteFile(build.ConfigFile, []byte(config), 0o644))
+		a := releaseArgs(t, filepath.Join(dir, "out"), "")
+		require.NoError(t, a.LoadConfig())
+
+		err := setKeystore(a, test.keystore, test.password)
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, "test #%d", i)
+			assert.Empty(t, a.Keystore(), "test #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "test #%d", i)
+		assert.Equal(t, test.want, a.Keystore(), "test #%d", i)
+	}
+}
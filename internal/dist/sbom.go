@@ -0,0 +1,131 @@
+package dist
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"gni.dev/cmd/internal/build"
+)
+
+// spdxDocument is the subset of an SPDX 2.3 JSON document gni produces.
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// newSBOM returns an SPDX document listing the modules linked into lib, as
+// recorded by the go command in the build info of the binary.
+func newSBOM(m build.Metadata, lib string) (*spdxDocument, error) {
+	info, err := buildinfo.ReadFile(lib)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build info of %s: %w", lib, err)
+	}
+
+	created := time.Now()
+	if m.BuildTime != nil {
+		created = *m.BuildTime
+	}
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              fmt.Sprintf("%s-%s", m.AppID, m.Version),
+		DocumentNamespace: fmt.Sprintf("https://gni.dev/spdx/%s-%s-%d-%d", m.AppID, m.Version, m.Build, created.Unix()),
+		CreationInfo: spdxCreationInfo{
+			Created:  created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: gni"},
+		},
+	}
+
+	root := spdxID(0)
+	doc.Packages = append(doc.Packages, goPackage(root, info.Main.Path, info.Main.Version))
+	doc.Relationships = append(doc.Relationships, spdxRelationship{
+		SPDXElementID:      doc.SPDXID,
+		RelationshipType:   "DESCRIBES",
+		RelatedSPDXElement: root,
+	})
+
+	deps := append([]*module{{"stdlib", strings.TrimPrefix(info.GoVersion, "go")}}, modules(info.Deps)...)
+	for i, d := range deps {
+		id := spdxID(i + 1)
+		doc.Packages = append(doc.Packages, goPackage(id, d.path, d.version))
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      root,
+			RelationshipType:   "DEPENDS_ON",
+			RelatedSPDXElement: id,
+		})
+	}
+	return doc, nil
+}
+
+type module struct {
+	path, version string
+}
+
+// modules returns the modules actually linked, following replacements.
+func modules(deps []*debug.Module) []*module {
+	var res []*module
+	for _, d := range deps {
+		if d.Replace != nil {
+			d = d.Replace
+		}
+		res = append(res, &module{d.Path, d.Version})
+	}
+	return res
+}
+
+func goPackage(id, path, version string) spdxPackage {
+	p := spdxPackage{
+		Name:             path,
+		SPDXID:           id,
+		VersionInfo:      version,
+		DownloadLocation: "NOASSERTION",
+	}
+	if version != "" && version != "(devel)" {
+		p.ExternalRefs = []spdxExternalRef{{
+			ReferenceCategory: "PACKAGE-MANAGER",
+			ReferenceType:     "purl",
+			ReferenceLocator:  fmt.Sprintf("pkg:golang/%s@%s", path, version),
+		}}
+	}
+	return p
+}
+
+func spdxID(i int) string {
+	return fmt.Sprintf("SPDXRef-Package-%d", i)
+}
@@ -0,0 +1,84 @@
+package dist
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gni.dev/cmd/internal/build"
+)
+
+func TestNewSBOM(t *testing.T) {
+	lib := buildLib(t)
+	bt := time.Unix(1700000000, 0).UTC()
+	m := build.Metadata{AppID: "com.example.app", Version: "1.2.0", Build: 3, BuildTime: &bt}
+
+	doc, err := newSBOM(m, lib)
+	require.NoError(t, err)
+	assert.Equal(t, "SPDX-2.3", doc.SPDXVersion)
+	assert.Equal(t, "CC0-1.0", doc.DataLicense)
+	assert.Equal(t, "SPDXRef-DOCUMENT", doc.SPDXID)
+	assert.Equal(t, "com.example.app-1.2.0", doc.Name)
+	assert.Equal(t, "https://gni.dev/spdx/com.example.app-1.2.0-3-1700000000", doc.DocumentNamespace)
+	assert.Equal(t, "2023-11-14T22:13:20Z", doc.CreationInfo.Created)
+
+	require.Len(t, doc.Packages, 2)
+	assert.Equal(t, "example.com/app", doc.Packages[0].Name)
+	assert.Equal(t, spdxPackage{
+		Name:             "stdlib",
+		SPDXID:           "SPDXRef-Package-1",
+		VersionInfo:      strings.TrimPrefix(runtime.Version(), "go"),
+		DownloadLocation: "NOASSERTION",
+		ExternalRefs: []spdxExternalRef{{
+			ReferenceCategory: "PACKAGE-MANAGER",
+			ReferenceType:     "purl",
+			ReferenceLocator:  "pkg:golang/stdlib@" + strings.TrimPrefix(runtime.Version(), "go"),
+		}},
+	}, doc.Packages[1])
+	assert.Equal(t, []spdxRelationship{
+		{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Package-0"},
+		{SPDXElementID: "SPDXRef-Package-0", RelationshipType: "DEPENDS_ON", RelatedSPDXElement: "SPDXRef-Package-1"},
+	}, doc.Relationships)
+}
+
+func TestModules(t *testing.T) {
+	deps := []*debug.Module{
+		{Path: "github.com/a/b", Version: "v1.0.0"},
+		{Path: "github.com/c/d", Version: "v0.1.0", Replace: &debug.Module{Path: "github.com/fork/d", Version: "v0.1.1"}},
+		{Path: "example.com/local", Version: "v0.0.0", Replace: &debug.Module{Path: "../local"}},
+	}
+	assert.Equal(t, []*module{
+		{"github.com/a/b", "v1.0.0"},
+		{"github.com/fork/d", "v0.1.1"},
+		{"../local", ""},
+	}, modules(deps))
+}
+
+func TestGoPackage(t *testing.T) {
+	tests := []struct {
+		path    string
+		version string
+		purl    string
+	}{
+		{path: "github.com/a/b", version: "v1.2.3", purl: "pkg:golang/github.com/a/b@v1.2.3"},
+		{path: "example.com/app", version: "(devel)"},
+		{path: "../local"},
+	}
+	for _, test := range tests {
+		p := goPackage("SPDXRef-Package-1", test.path, test.version)
+		assert.Equal(t, test.path, p.Name)
+		assert.Equal(t, test.version, p.VersionInfo)
+		assert.Equal(t, "NOASSERTION", p.DownloadLocation)
+		if test.purl == "" {
+			assert.Empty(t, p.ExternalRefs, test.path)
+			continue
+		}
+		if assert.Len(t, p.ExternalRefs, 1, test.path) {
+			assert.Equal(t, test.purl, p.ExternalRefs[0].ReferenceLocator)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package keygen
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gni.dev/cmd/internal/build"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func Run(args []string) {
+	var (
+		out     string
+		alg     string
+		bits    int
+		subject string
+		years   int
+	)
+	keyFlags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	keyFlags.StringVar(&out, "o", "release.p12", "Output PKCS#12 file")
+	keyFlags.StringVar(&alg, "alg", "rsa", "Key algorithm: rsa or ec")
+	keyFlags.IntVar(&bits, "bits", 4096, "RSA key size")
+	keyFlags.StringVar(&subject, "subject", "CN=Android Release", "Certificate subject, e.g. \"CN=Name, O=Org, C=US\"")
+	keyFlags.IntVar(&years, "years", 30, "Certificate validity in years")
+	if err := keyFlags.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// the password is not a flag, which would leave it in the shell
+	// history and the process list
+	password := os.Getenv(build.KeystorePasswordEnv)
+	if err := keygen(os.Stdout, out, alg, bits, subject, years, password); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// keygen writes a new keystore to out and describes it to w.
+func keygen(w io.Writer, out, alg string, bits int, subject string, years int, password string) error {
+	if password == "" {
+		return fmt.Errorf("keystore password is required, set $%s", build.KeystorePasswordEnv)
+	}
+	if _, err := os.Stat(out); err == nil {
+		return fmt.Errorf("%s already exists", out)
+	}
+	name, err := parseSubject(subject)
+	if err != nil {
+		return err
+	}
+
+	key, err := build.GenerateKey(alg, bits)
+	if err != nil {
+		return err
+	}
+	cert, err := build.NewCertificate(key, name, time.Now(), years)
+	if err != nil {
+		return err
+	}
+	pfx, err := pkcs12.Modern.Encode(key, cert, nil, password)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(out, pfx, 0600); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Keystore written to %s\n", out)
+	fmt.Fprintf(w, "Subject: %s\n", cert.Subject)
+	fmt.Fprintf(w, "Valid until: %s\n", cert.NotAfter.Format(time.RFC1123))
+	sum1 := sha1.Sum(cert.Raw)
+	sum256 := sha256.Sum256(cert.Raw)
+	fmt.Fprintf(w, "SHA1: %s\n", fingerprint(sum1[:]))
+	fmt.Fprintf(w, "SHA256: %s\n", fingerprint(sum256[:]))
+	return nil
+}
+
+// parseSubject parses a distinguished name like "CN=Name, O=Org, C=US".
+func parseSubject(s string) (pkix.Name, error) {
+	var name pkix.Name
+	for _, attr := range strings.Split(s, ",") {
+		attr = strings.TrimSpace(attr)
+		if attr == "" {
+			continue
+		}
+		kv := strings.SplitN(attr, "=", 2)
+		if len(kv) != 2 {
+			return pkix.Name{}, fmt.Errorf("invalid subject attribute %q", attr)
+		}
+		key, val := strings.ToUpper(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1])
+		switch key {
+		case "CN":
+			name.CommonName = val
+		case "O":
+			name.Organization = append(name.Organization, val)
+		case "OU":
+			name.OrganizationalUnit = append(name.OrganizationalUnit, val)
+		case "L":
+			name.Locality = append(name.Locality, val)
+		case "ST":
+			name.Province = append(name.Province, val)
+		case "C":
+			name.Country = append(name.Country, val)
+		default:
+			return pkix.Name{}, fmt.Errorf("unsupported subject attribute %q", key)
+		}
+	}
+	if name.CommonName == "" {
+		return pkix.Name{}, fmt.Errorf("subject must have a CN")
+	}
+	return name, nil
+}
+
+func fingerprint(sum []byte) string {
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hex, ":")
+}
@@ -0,0 +1,93 @@
+package keygen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gni.dev/cmd/internal/build"
+)
+
+func TestParseSubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    pkix.Name
+		err     string
+	}{
+		{
+			subject: "CN=Android Release",
+			want:    pkix.Name{CommonName: "Android Release"},
+		},
+		{
+			subject: " cn = Name , O=Org, OU=Mobile, L=Paris, ST=IDF, C=FR,",
+			want: pkix.Name{
+				CommonName:         "Name",
+				Organization:       []string{"Org"},
+				OrganizationalUnit: []string{"Mobile"},
+				Locality:           []string{"Paris"},
+				Province:           []string{"IDF"},
+				Country:            []string{"FR"},
+			},
+		},
+		{
+			subject: "CN=Name, O=One, O=Two",
+			want:    pkix.Name{CommonName: "Name", Organization: []string{"One", "Two"}},
+		},
+		{
+			subject: "CN=a=b",
+			want:    pkix.Name{CommonName: "a=b"},
+		},
+		{subject: "O=Org", err: "subject must have a CN"},
+		{subject: "", err: "subject must have a CN"},
+		{subject: "CN=Name, Org", err: `invalid subject attribute "Org"`},
+		{subject: "CN=Name, E=me@example.com", err: `unsupported subject attribute "E"`},
+	}
+	for _, test := range tests {
+		got, err := parseSubject(test.subject)
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, test.subject)
+			continue
+		}
+		if assert.NoError(t, err, test.subject) {
+			assert.Equal(t, test.want, got, test.subject)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		sum  []byte
+		want string
+	}{
+		{sum: nil, want: ""},
+		{sum: []byte{0x0a}, want: "0A"},
+		{sum: []byte{0x00, 0xff, 0x1b}, want: "00:FF:1B"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, fingerprint(test.sum))
+	}
+}
+
+func TestKeygen(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "release.p12")
+	var w bytes.Buffer
+	err := keygen(&w, out, "ec", 0, "CN=Release", 1, "")
+	assert.ErrorContains(t, err, build.KeystorePasswordEnv)
+
+	require.NoError(t, keygen(&w, out, "ec", 0, "CN=Release, O=Org", 1, "secret"))
+	_, cert, err := build.LoadKeystore(out, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "Release", cert.Subject.CommonName)
+
+	// the printed fingerprint is the one apps are signed with
+	sum := sha256.Sum256(cert.Raw)
+	assert.Contains(t, w.String(), "Subject: CN=Release,O=Org\n")
+	assert.Contains(t, w.String(), "SHA256: "+fingerprint(sum[:])+"\n")
+
+	err = keygen(&w, out, "ec", 0, "CN=Release", 1, "secret")
+	assert.ErrorContains(t, err, "already exists")
+}
@@ -1,49 +1,113 @@
 package run
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 )
 
+// ADB talks to a device through the adb server.
 type ADB struct {
-	adbCmd string
+	addr   string
 	serial string
+
+	featuresOnce sync.Once
+	features     map[string]bool
+}
+
+// Device is an Android device as listed by adb.
+type Device struct {
+	Serial string
+	// State is the adb connection state: device, unauthorized, offline...
+	State string
+	Model string
+	API   int
+	ABI   string
+}
+
+// Ready reports whether the device can be used.
+func (d *Device) Ready() bool {
+	return d.State == "device"
 }
 
 func AndroidDevices(androidHome string) ([]string, error) {
-	adbCmd, err := makeADBCmd(androidHome)
+	all, err := listDevices(androidHome)
 	if err != nil {
 		return nil, err
 	}
+	devices := make([]string, 0, len(all))
+	for _, d := range all {
+		if d.Ready() {
+			devices = append(devices, d.Serial)
+		}
+	}
+	return devices, nil
+}
 
-	cmd := exec.Command(adbCmd, "devices")
-	out, err := cmd.CombinedOutput()
+// ListDevices returns all devices known to adb. The API level and ABI are
+// only filled in for ready devices.
+func ListDevices(androidHome string) ([]Device, error) {
+	devices, err := listDevices(androidHome)
 	if err != nil {
-		return nil, fmt.Errorf("failed to run %s:\n%s", cmd, string(out))
+		return nil, err
 	}
+	for i := range devices {
+		d := &devices[i]
+		if !d.Ready() {
+			continue
+		}
+		adb, err := NewADB(androidHome, d.Serial)
+		if err != nil {
+			return nil, err
+		}
+		if sdk, err := adb.GetProp("ro.build.version.sdk"); err == nil {
+			d.API, _ = strconv.Atoi(sdk)
+		}
+		d.ABI, _ = adb.GetProp("ro.product.cpu.abi")
+	}
+	return devices, nil
+}
 
-	lines := strings.Split(string(out), "\n")
-	if len(lines) < 2 {
-		return nil, fmt.Errorf("failed to parse adb devices output: %s", out)
+func listDevices(androidHome string) ([]Device, error) {
+	addr, err := startServer(androidHome)
+	if err != nil {
+		return nil, err
+	}
+	out, err := hostQuery(addr, "host:devices-l")
+	if err != nil {
+		return nil, err
 	}
-	devices := make([]string, 0, len(lines)-1)
-	for _, l := range lines[1:] {
-		line := strings.TrimSpace(l)
-		if line == "" {
+	return parseDevices(out)
+}
+
+func parseDevices(out string) ([]Device, error) {
+	lines := strings.Split(out, "\n")
+	var devices []Device
+	for _, l := range lines {
+		fields := strings.Fields(l)
+		// skip the header and the messages of a starting adb server
+		if len(fields) == 0 || strings.HasPrefix(l, "*") || strings.HasPrefix(l, "List of devices") {
 			continue
 		}
-		parts := strings.Split(line, "\t")
-		if len(parts) != 2 {
+		if len(fields) < 2 {
 			return nil, fmt.Errorf("failed to parse adb devices output: %s", out)
 		}
-		if parts[1] != "device" {
-			continue
+		d := Device{Serial: fields[0], State: fields[1]}
+		for _, f := range fields[2:] {
+			if strings.HasPrefix(f, "model:") {
+				d.Model = strings.ReplaceAll(strings.TrimPrefix(f, "model:"), "_", " ")
+			}
 		}
-		devices = append(devices, parts[0])
+		devices = append(devices, d)
 	}
 	return devices, nil
 }
@@ -60,51 +124,196 @@ func makeADBCmd(androidHome string) (string, error) {
 	return "", fmt.Errorf("failed to find adb")
 }
 
-func NewADB(androidHome, serial string) (*ADB, error) {
+// startServer makes sure the adb server is running, starting it with the
+// adb command of the SDK if needed, and returns its address.
+func startServer(androidHome string) (string, error) {
+	addr := adbServerAddr()
+	if c, err := dialADB(addr); err == nil {
+		c.Close()
+		return addr, nil
+	}
+
 	adbCmd, err := makeADBCmd(androidHome)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command(adbCmd, "start-server")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to run %s:\n%s", cmd, string(out))
+	}
+	return addr, nil
+}
+
+// hostQuery runs a host service returning a string, like host:devices.
+func hostQuery(addr, service string) (string, error) {
+	c, err := dialADB(addr)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	if err := c.request(service); err != nil {
+		return "", err
+	}
+	return c.readString()
+}
+
+func NewADB(androidHome, serial string) (*ADB, error) {
+	addr, err := startServer(androidHome)
 	if err != nil {
 		return nil, err
 	}
-	return &ADB{adbCmd: adbCmd, serial: serial}, nil
+	return &ADB{addr: addr, serial: serial}, nil
 }
 
 func (a *ADB) Install(fileName string, replace bool) error {
-	args := []string{"install"}
+	remote := path.Join("/data/local/tmp", filepath.Base(fileName))
+	if err := a.Push(fileName, remote); err != nil {
+		return err
+	}
+	defer a.Shell("rm", "-f", remote)
+
+	args := []string{"pm", "install"}
 	if replace {
 		args = append(args, "-r")
 	}
-	args = append(args, fileName)
-	return a.call(args...)
+	args = append(args, remote)
+	out, err := a.Shell(args...)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(out, "Success") {
+		return fmt.Errorf("failed to install %s:\n%s", fileName, out)
+	}
+	return nil
 }
 
 func (a *ADB) Uninstall(pkg string) error {
-	return a.call("uninstall", pkg)
+	_, err := a.Shell("pm", "uninstall", pkg)
+	return err
 }
 
 func (a *ADB) Push(local, remote string) error {
-	return a.call("push", local, remote)
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	c, err := a.open("sync:")
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if st, err := c.stat(remote); err == nil && st.isDir() {
+		remote = path.Join(remote, filepath.Base(local))
+	}
+	spec := fmt.Sprintf("%s,%d", remote, modeRegular|uint32(fi.Mode().Perm()))
+	if err := c.writeSync("SEND", uint32(len(spec)), []byte(spec)); err != nil {
+		return err
+	}
+	buf := make([]byte, syncMaxChunk)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if err := c.writeSync("DATA", uint32(n), buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := c.writeSync("DONE", uint32(fi.ModTime().Unix()), nil); err != nil {
+		return err
+	}
+	if err := c.syncStatus(); err != nil {
+		return fmt.Errorf("failed to push %s to %s: %w", local, remote, err)
+	}
+	return nil
 }
 
 func (a *ADB) Pull(remote, local string) error {
-	return a.call("pull", remote, local)
+	c, err := a.open("sync:")
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	st, err := c.stat(remote)
+	if err != nil {
+		return err
+	}
+	if st.mode == 0 {
+		return fmt.Errorf("failed to pull %s: no such file", remote)
+	}
+	if fi, err := os.Stat(local); err == nil && fi.IsDir() {
+		local = filepath.Join(local, path.Base(remote))
+	}
+
+	if err := c.writeSync("RECV", uint32(len(remote)), []byte(remote)); err != nil {
+		return err
+	}
+	f, err := os.Create(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for {
+		id, n, err := c.readSync()
+		if err != nil {
+			return err
+		}
+		switch id {
+		case "DATA":
+			if _, err := io.CopyN(f, c, int64(n)); err != nil {
+				return err
+			}
+		case "DONE":
+			return f.Close()
+		case adbFail:
+			return fmt.Errorf("failed to pull %s: %w", remote, c.syncFail(n))
+		default:
+			return fmt.Errorf("adb: unexpected sync reply %q", id)
+		}
+	}
 }
 
 func (a *ADB) Shell(args ...string) (string, error) {
-	args = append([]string{"-s", a.serial, "shell"}, args...)
-	cmd := exec.Command(a.adbCmd, args...)
-	out, err := cmd.CombinedOutput()
+	var out bytes.Buffer
+	code, err := a.shell(context.Background(), nil, &out, &out, args...)
 	if err != nil {
-		return "", fmt.Errorf("failed to run %s:\n%s", cmd, string(out))
+		return "", err
+	}
+	if code != 0 {
+		return "", fmt.Errorf("failed to run adb shell %s (exit status %d):\n%s", shellJoin(args), code, out.String())
 	}
-	return strings.TrimSpace(string(out)), nil
+	return strings.TrimSpace(out.String()), nil
 }
 
 func (a *ADB) Forward(local, remote string) error {
-	return a.call("forward", local, remote)
+	return a.hostSerial("forward:" + local + ";" + remote)
 }
 
 func (a *ADB) ForwardRemove(local string) error {
-	return a.call("forward", "--remove", local)
+	return a.hostSerial("killforward:" + local)
+}
+
+// Reverse makes connections to remote on the device reach local on the
+// workstation.
+func (a *ADB) Reverse(remote, local string) error {
+	return a.deviceCommand("reverse:forward:" + remote + ";" + local)
+}
+
+func (a *ADB) ReverseRemove(remote string) error {
+	return a.deviceCommand("reverse:killforward:" + remote)
 }
 
 func (a *ADB) GetProp(prop string) (string, error) {
@@ -120,7 +329,8 @@ func (a *ADB) GetProp(prop string) (string, error) {
 }
 
 func (a *ADB) SetProp(prop, value string) error {
-	return a.call("shell", "setprop", prop, value)
+	_, err := a.Shell("setprop", prop, value)
+	return err
 }
 
 func (a *ADB) RunAs(pkg string, args ...string) (string, error) {
@@ -128,11 +338,267 @@ func (a *ADB) RunAs(pkg string, args ...string) (string, error) {
 	return a.Shell(args...)
 }
 
-func (a *ADB) call(args ...string) error {
-	args = append([]string{"-s", a.serial}, args...)
-	cmd := exec.Command(a.adbCmd, args...)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to run %s:\n%s", cmd, string(out))
+// open connects to a service of the device.
+func (a *ADB) open(service string) (*adbConn, error) {
+	c, err := dialADB(a.addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.request("host:transport:" + a.serial); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := c.request(service); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// hostSerial runs a host service for the device which replies with a
+// second status once done, like forward.
+func (a *ADB) hostSerial(cmd string) error {
+	c, err := dialADB(a.addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	service := "host-serial:" + a.serial + ":" + cmd
+	if err := c.request(service); err != nil {
+		return err
+	}
+	return c.status(service)
+}
+
+// deviceCommand runs a service of the device which replies with a second
+// status once done, like reverse.
+func (a *ADB) deviceCommand(service string) error {
+	c, err := a.open(service)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.status(service)
+}
+
+// hasFeature reports whether the device and the adb server support the
+// feature, like shell_v2. The features are queried once.
+func (a *ADB) hasFeature(feature string) bool {
+	a.featuresOnce.Do(func() {
+		a.features = make(map[string]bool)
+		out, err := hostQuery(a.addr, "host-serial:"+a.serial+":features")
+		if err != nil {
+			return
+		}
+		for _, f := range strings.Split(strings.TrimSpace(out), ",") {
+			a.features[f] = true
+		}
+	})
+	return a.features[feature]
+}
+
+// needShellV2 fails if the device lacks the shell protocol v2, which what
+// needs to get binary output or send input.
+func (a *ADB) needShellV2(what string) error {
+	if !a.hasFeature("shell_v2") {
+		return fmt.Errorf("%s needs Android 7.0 or later on %s", what, a.serial)
 	}
 	return nil
 }
+
+// shell runs a command on the device, copying stdin to the command and its
+// output to stdout and stderr. It returns the exit code of the command.
+// Canceling ctx kills the command.
+//
+// Devices before Android 7.0 lack the shell protocol v2: their command
+// output goes to stdout only and stdin isn't supported.
+func (a *ADB) shell(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, args ...string) (int, error) {
+	if !a.hasFeature("shell_v2") {
+		if stdin != nil {
+			return 0, a.needShellV2("adb shell " + shellJoin(args))
+		}
+		return a.shellLegacy(ctx, stdout, args...)
+	}
+	c, err := a.open("shell,v2,raw:" + shellJoin(args))
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+
+	if stdin != nil {
+		go func() {
+			buf := make([]byte, syncMaxChunk)
+			for {
+				n, err := stdin.Read(buf)
+				if n > 0 {
+					if c.writeShellPacket(shellStdin, buf[:n]) != nil {
+						return
+					}
+				}
+				if err != nil {
+					break
+				}
+			}
+			c.writeShellPacket(shellCloseStdin, nil)
+		}()
+	}
+
+	for {
+		id, data, err := c.readShellPacket()
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			return 0, fmt.Errorf("adb shell %s: %w", shellJoin(args), err)
+		}
+		switch id {
+		case shellStdout:
+			if _, err := stdout.Write(data); err != nil {
+				return 0, err
+			}
+		case shellStderr:
+			if _, err := stderr.Write(data); err != nil {
+				return 0, err
+			}
+		case shellExit:
+			if len(data) != 1 {
+				return 0, fmt.Errorf("adb shell %s: invalid exit packet", shellJoin(args))
+			}
+			return int(data[0]), nil
+		}
+	}
+}
+
+// exitMarker prefixes the exit code printed after the command by
+// shellLegacy.
+const exitMarker = "\x1fgni-exit:"
+
+// shellLegacy runs a command with the shell service of devices without the
+// shell protocol v2. The exit code is printed after the command output,
+// and the line endings turned to CRLF by the terminal of the device are
+// restored.
+func (a *ADB) shellLegacy(ctx context.Context, stdout io.Writer, args ...string) (int, error) {
+	cmd := shellJoin(args)
+	c, err := a.open("shell:" + cmd + "; echo " + shellQuote(exitMarker) + "$?")
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+
+	w := &exitCodeWriter{w: stdout}
+	if _, err := io.Copy(w, c); err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, fmt.Errorf("adb shell %s: %w", cmd, err)
+	}
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	code, ok, err := w.exitCode()
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("adb shell %s: no exit status", cmd)
+	}
+	return code, nil
+}
+
+// exitCodeWriter copies the output of shellLegacy to w, holding back the
+// last line until the end as it may hold the exit code.
+type exitCodeWriter struct {
+	w    io.Writer
+	tail []byte
+}
+
+func (e *exitCodeWriter) Write(b []byte) (int, error) {
+	e.tail = append(e.tail, b...)
+	last := e.tail
+	if len(last) > 0 && last[len(last)-1] == '\n' {
+		last = last[:len(last)-1]
+	}
+	i := bytes.LastIndexByte(last, '\n')
+	if i < 0 {
+		return len(b), nil
+	}
+	if _, err := e.w.Write(crlfToLF(e.tail[:i+1])); err != nil {
+		return 0, err
+	}
+	e.tail = append([]byte(nil), e.tail[i+1:]...)
+	return len(b), nil
+}
+
+// exitCode writes the output left before the exit code and returns it.
+func (e *exitCodeWriter) exitCode() (int, bool, error) {
+	i := bytes.LastIndex(e.tail, []byte(exitMarker))
+	if i < 0 {
+		_, err := e.w.Write(crlfToLF(e.tail))
+		return 0, false, err
+	}
+	if _, err := e.w.Write(crlfToLF(e.tail[:i])); err != nil {
+		return 0, false, err
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(string(e.tail[i+len(exitMarker):])))
+	if err != nil {
+		return 0, false, nil
+	}
+	return code, true, nil
+}
+
+func crlfToLF(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+}
+
+// execOut runs a command on the device without the shell protocol and
+// copies its raw output to w, like adb exec-out.
+func (a *ADB) execOut(w io.Writer, args ...string) error {
+	c, err := a.open("exec:" + shellJoin(args))
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	_, err = io.Copy(w, c)
+	return err
+}
+
+// shellJoin joins args into a command line for the device shell, quoting
+// the arguments that need it.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shellQuote(s string) string {
+	safe := func(r rune) bool {
+		return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			strings.ContainsRune("@%+=:,./-_", r)
+	}
+	if s != "" && strings.IndexFunc(s, func(r rune) bool { return !safe(r) }) == -1 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,255 @@
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeADB is an adb server with a single device storing pushed files in
+// memory and echoing shell commands, unless handled by shell. A legacy
+// device lacks the shell protocol v2.
+type fakeADB struct {
+	l        net.Listener
+	legacy   bool
+	shell    func(cmd string) (string, int)
+	files    map[string][]byte
+	forwards []string
+	removed  []string
+	reverses []string
+}
+
+func newFakeADB(t *testing.T) *fakeADB {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	s := &fakeADB{l: l, files: map[string][]byte{}}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.serve(&adbConn{Conn: c, r: bufio.NewReader(c)})
+		}
+	}()
+	return s
+}
+
+func (s *fakeADB) serve(c *adbConn) {
+	defer c.Close()
+	for {
+		service, err := c.readString()
+		if err != nil {
+			return
+		}
+		switch {
+		case service == "host:transport:emulator-5554":
+			io.WriteString(c, adbOkay)
+		case service == "host:devices-l":
+			out := "emulator-5554 device product:sdk model:sdk_gphone64 device:emu64 transport_id:1\n"
+			fmt.Fprintf(c, "%s%04x%s", adbOkay, len(out), out)
+			return
+		case service == "host-serial:emulator-5554:features":
+			out := "shell_v2,cmd,stat_v2"
+			if s.legacy {
+				out = "cmd"
+			}
+			fmt.Fprintf(c, "%s%04x%s", adbOkay, len(out), out)
+			return
+		case strings.HasPrefix(service, "host-serial:emulator-5554:killforward:"):
+			s.removed = append(s.removed, strings.TrimPrefix(service, "host-serial:emulator-5554:killforward:"))
+			io.WriteString(c, adbOkay+adbOkay)
+			return
+		case strings.HasPrefix(service, "host-serial:emulator-5554:forward:"):
+			s.forwards = append(s.forwards, strings.TrimPrefix(service, "host-serial:emulator-5554:forward:"))
+			io.WriteString(c, adbOkay+adbOkay)
+			return
+		case strings.HasPrefix(service, "shell,v2,raw:"):
+			io.WriteString(c, adbOkay)
+			cmd := strings.TrimPrefix(service, "shell,v2,raw:")
+			if s.shell != nil {
+				out, code := s.shell(cmd)
+				c.writeShellPacket(shellStdout, []byte(out))
+				c.writeShellPacket(shellExit, []byte{byte(code)})
+				return
+			}
+			if strings.HasPrefix(cmd, "false") {
+				c.writeShellPacket(shellStderr, []byte("failed\n"))
+				c.writeShellPacket(shellExit, []byte{1})
+				return
+			}
+			c.writeShellPacket(shellStdout, []byte(cmd+"\n"))
+			c.writeShellPacket(shellExit, []byte{0})
+			return
+		case strings.HasPrefix(service, "shell:"):
+			// the terminal of old devices turns LF into CRLF
+			io.WriteString(c, adbOkay)
+			cmd, marker, _ := strings.Cut(strings.TrimPrefix(service, "shell:"), "; echo ")
+			marker = strings.Trim(strings.TrimSuffix(marker, "$?"), "'")
+			code := "0"
+			if strings.HasPrefix(cmd, "false") {
+				io.WriteString(c, "failed\r\n")
+				code = "1"
+			} else {
+				io.WriteString(c, cmd+"\r\n")
+			}
+			io.WriteString(c, marker+code+"\r\n")
+			return
+		case strings.HasPrefix(service, "reverse:forward:"):
+			s.reverses = append(s.reverses, strings.TrimPrefix(service, "reverse:forward:"))
+			io.WriteString(c, adbOkay+adbOkay)
+			return
+		case strings.HasPrefix(service, "exec:"):
+			io.WriteString(c, adbOkay)
+			io.WriteString(c, "\x89PNG\r\n")
+			return
+		case service == "sync:":
+			io.WriteString(c, adbOkay)
+			s.serveSync(c)
+			return
+		default:
+			fmt.Fprintf(c, "%s%04x%s", adbFail, len("unknown service"), "unknown service")
+			return
+		}
+	}
+}
+
+func (s *fakeADB) serveSync(c *adbConn) {
+	for {
+		id, n, err := c.readSync()
+		if err != nil {
+			return
+		}
+		arg := make([]byte, n)
+		io.ReadFull(c.r, arg)
+		switch id {
+		case "STAT":
+			st := make([]byte, 12)
+			if string(arg) == "/data/local/tmp" {
+				binary.LittleEndian.PutUint32(st, modeDir|0771)
+			} else if _, ok := s.files[string(arg)]; ok {
+				binary.LittleEndian.PutUint32(st, modeRegular|0644)
+			}
+			io.WriteString(c, "STAT")
+			c.Write(st)
+		case "SEND":
+			name := string(arg[:bytes.LastIndexByte(arg, ',')])
+			var data []byte
+			for {
+				id, n, _ := c.readSync()
+				if id == "DONE" {
+					break
+				}
+				chunk := make([]byte, n)
+				io.ReadFull(c.r, chunk)
+				data = append(data, chunk...)
+			}
+			s.files[name] = data
+			c.writeSync(adbOkay, 0, nil)
+		case "RECV":
+			data := s.files[string(arg)]
+			c.writeSync("DATA", uint32(len(data)), data)
+			c.writeSync("DONE", 0, nil)
+		}
+	}
+}
+
+func TestADB(t *testing.T) {
+	s := newFakeADB(t)
+	a := &ADB{addr: s.l.Addr().String(), serial: "emulator-5554"}
+
+	out, err := a.Shell("echo", "hello world", "it's")
+	require.NoError(t, err)
+	assert.Equal(t, `echo 'hello world' 'it'\''s'`, out)
+
+	_, err = a.Shell("false")
+	assert.ErrorContains(t, err, "exit status 1")
+	assert.ErrorContains(t, err, "failed")
+
+	var png bytes.Buffer
+	require.NoError(t, a.execOut(&png, "screencap", "-p"))
+	assert.Equal(t, "\x89PNG\r\n", png.String())
+
+	dir := t.TempDir()
+	local := filepath.Join(dir, "app.apk")
+	require.NoError(t, os.WriteFile(local, bytes.Repeat([]byte("apk"), syncMaxChunk), 0o644))
+	require.NoError(t, a.Push(local, "/data/local/tmp"))
+	assert.Len(t, s.files["/data/local/tmp/app.apk"], 3*syncMaxChunk)
+
+	pulled := filepath.Join(dir, "pulled")
+	require.NoError(t, os.Mkdir(pulled, 0o755))
+	require.NoError(t, a.Pull("/data/local/tmp/app.apk", pulled))
+	data, err := os.ReadFile(filepath.Join(pulled, "app.apk"))
+	require.NoError(t, err)
+	assert.Equal(t, s.files["/data/local/tmp/app.apk"], data)
+	assert.ErrorContains(t, a.Pull("/data/local/tmp/missing", pulled), "no such file")
+
+	require.NoError(t, a.Forward("tcp:5039", "localfilesystem:/data/local/tmp/debug.sock"))
+	assert.Equal(t, []string{"tcp:5039;localfilesystem:/data/local/tmp/debug.sock"}, s.forwards)
+
+	require.NoError(t, a.Reverse("tcp:8080", "tcp:8080"))
+	assert.Equal(t, []string{"tcp:8080;tcp:8080"}, s.reverses)
+
+	out, err = hostQuery(a.addr, "host:devices-l")
+	require.NoError(t, err)
+	devices, err := parseDevices(out)
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.Equal(t, "emulator-5554", devices[0].Serial)
+	assert.Equal(t, "sdk gphone64", devices[0].Model)
+}
+
+func TestADBLegacyShell(t *testing.T) {
+	s := newFakeADB(t)
+	s.legacy = true
+	a := &ADB{addr: s.l.Addr().String(), serial: "emulator-5554"}
+
+	out, err := a.Shell("echo", "hello world")
+	require.NoError(t, err)
+	assert.Equal(t, `echo 'hello world'`, out)
+
+	_, err = a.Shell("false")
+	assert.ErrorContains(t, err, "exit status 1")
+	assert.ErrorContains(t, err, "failed")
+
+	_, err = a.shell(context.Background(), strings.NewReader("input"), io.Discard, io.Discard, "cat")
+	assert.ErrorContains(t, err, "Android 7.0")
+}
+
+func TestExitCodeWriter(t *testing.T) {
+	tests := []struct {
+		chunks []string
+		out    string
+		code   int
+		ok     bool
+	}{
+		{[]string{"a\r\nb\r\n" + exitMarker + "0\r\n"}, "a\nb\n", 0, true},
+		{[]string{"a\r", "\nno newline", exitMarker + "12\r\n"}, "a\nno newline", 12, true},
+		{[]string{"a\r\n", exitMarker[:3], exitMarker[3:] + "2\r\n"}, "a\n", 2, true},
+		{[]string{"killed\r\n"}, "killed\n", 0, false},
+	}
+	for i, test := range tests {
+		var out bytes.Buffer
+		w := &exitCodeWriter{w: &out}
+		for _, c := range test.chunks {
+			w.Write([]byte(c))
+		}
+		code, ok, err := w.exitCode()
+		require.NoError(t, err)
+		assert.Equal(t, test.out, out.String(), "test #%d", i)
+		assert.Equal(t, test.code, code, "test #%d", i)
+		assert.Equal(t, test.ok, ok, "test #%d", i)
+	}
+}
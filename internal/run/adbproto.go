@@ -0,0 +1,224 @@
+package run
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The adb server speaks the smart socket protocol: a request is a service
+// name prefixed by its length as 4 hex digits, answered by OKAY or by FAIL
+// followed by a length-prefixed message.
+const (
+	adbOkay = "OKAY"
+	adbFail = "FAIL"
+)
+
+// Shell protocol v2 packet ids.
+const (
+	shellStdin      = 0
+	shellStdout     = 1
+	shellStderr     = 2
+	shellExit       = 3
+	shellCloseStdin = 4
+)
+
+// syncMaxChunk is the greatest data chunk of the sync protocol.
+const syncMaxChunk = 64 * 1024
+
+// adbServerAddr returns the address of the adb server, honoring the
+// environment variables of the adb command.
+func adbServerAddr() string {
+	if s := os.Getenv("ADB_SERVER_SOCKET"); strings.HasPrefix(s, "tcp:") {
+		addr := strings.TrimPrefix(s, "tcp:")
+		if !strings.Contains(addr, ":") {
+			addr = "localhost:" + addr
+		}
+		return addr
+	}
+	host := os.Getenv("ANDROID_ADB_SERVER_ADDRESS")
+	if host == "" {
+		host = "localhost"
+	}
+	port := os.Getenv("ANDROID_ADB_SERVER_PORT")
+	if port == "" {
+		port = "5037"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+type adbConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func dialADB(addr string) (*adbConn, error) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &adbConn{Conn: c, r: bufio.NewReader(c)}, nil
+}
+
+func (c *adbConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// request sends a service request and waits for the server to accept it.
+func (c *adbConn) request(service string) error {
+	if _, err := fmt.Fprintf(c.Conn, "%04x%s", len(service), service); err != nil {
+		return err
+	}
+	return c.status(service)
+}
+
+func (c *adbConn) status(service string) error {
+	st := make([]byte, 4)
+	if _, err := io.ReadFull(c.r, st); err != nil {
+		return err
+	}
+	switch string(st) {
+	case adbOkay:
+		return nil
+	case adbFail:
+		msg, err := c.readString()
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("adb: %s: %s", service, msg)
+	default:
+		return fmt.Errorf("adb: %s: unexpected status %q", service, st)
+	}
+}
+
+// readString reads a string prefixed by its length as 4 hex digits.
+func (c *adbConn) readString() (string, error) {
+	hexLen := make([]byte, 4)
+	if _, err := io.ReadFull(c.r, hexLen); err != nil {
+		return "", err
+	}
+	n, err := strconv.ParseUint(string(hexLen), 16, 32)
+	if err != nil {
+		return "", fmt.Errorf("adb: invalid length %q", hexLen)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// writeShellPacket writes a shell protocol v2 packet.
+func (c *adbConn) writeShellPacket(id byte, data []byte) error {
+	hdr := make([]byte, 5)
+	hdr[0] = id
+	binary.LittleEndian.PutUint32(hdr[1:], uint32(len(data)))
+	if _, err := c.Write(hdr); err != nil {
+		return err
+	}
+	_, err := c.Write(data)
+	return err
+}
+
+func (c *adbConn) readShellPacket() (byte, []byte, error) {
+	hdr := make([]byte, 5)
+	if _, err := io.ReadFull(c.r, hdr); err != nil {
+		return 0, nil, err
+	}
+	data := make([]byte, binary.LittleEndian.Uint32(hdr[1:]))
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0], data, nil
+}
+
+// writeSync writes a sync protocol request or data packet.
+func (c *adbConn) writeSync(id string, arg uint32, data []byte) error {
+	hdr := make([]byte, 8)
+	copy(hdr, id)
+	binary.LittleEndian.PutUint32(hdr[4:], arg)
+	if _, err := c.Write(hdr); err != nil {
+		return err
+	}
+	_, err := c.Write(data)
+	return err
+}
+
+func (c *adbConn) readSync() (string, uint32, error) {
+	hdr := make([]byte, 8)
+	if _, err := io.ReadFull(c.r, hdr); err != nil {
+		return "", 0, err
+	}
+	return string(hdr[:4]), binary.LittleEndian.Uint32(hdr[4:]), nil
+}
+
+// syncStatus reads the reply to a sync request not returning data.
+func (c *adbConn) syncStatus() error {
+	id, n, err := c.readSync()
+	if err != nil {
+		return err
+	}
+	switch id {
+	case adbOkay:
+		return nil
+	case adbFail:
+		return c.syncFail(n)
+	default:
+		return fmt.Errorf("adb: unexpected sync reply %q", id)
+	}
+}
+
+func (c *adbConn) syncFail(n uint32) error {
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(c.r, msg); err != nil {
+		return err
+	}
+	return errors.New("adb: " + string(msg))
+}
+
+// File type bits of the mode reported by the sync protocol.
+const (
+	modeType    = 0170000
+	modeDir     = 0040000
+	modeRegular = 0100000
+)
+
+type syncStat struct {
+	mode  uint32
+	size  uint32
+	mtime uint32
+}
+
+func (st syncStat) isDir() bool {
+	return st.mode&modeType == modeDir
+}
+
+// stat returns the mode, size and mtime of a remote file. The mode is zero
+// if the file doesn't exist.
+func (c *adbConn) stat(remote string) (syncStat, error) {
+	if err := c.writeSync("STAT", uint32(len(remote)), []byte(remote)); err != nil {
+		return syncStat{}, err
+	}
+	id, mode, err := c.readSync()
+	if err != nil {
+		return syncStat{}, err
+	}
+	if id != "STAT" {
+		return syncStat{}, fmt.Errorf("adb: unexpected sync reply %q", id)
+	}
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		return syncStat{}, err
+	}
+	return syncStat{
+		mode:  mode,
+		size:  binary.LittleEndian.Uint32(buf),
+		mtime: binary.LittleEndian.Uint32(buf[4:]),
+	}, nil
+}
@@ -1,15 +1,13 @@
 package run
 
 import (
-	"archive/zip"
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
-	"path"
-	"path/filepath"
+	"os/signal"
+	"strings"
 
 	"gni.dev/cmd/internal/build"
 )
@@ -17,163 +15,127 @@ import (
 const mainActivity = "dev.gni.GniActivity"
 
 func runAndroid(m build.Metadata, a *Args) error {
-	fmt.Printf("Building package %s...\n", m.Name)
-	a.buildArgs.WaitDebugger(a.wait)
-	if err := build.BuildAndroid(m, a.buildArgs); err != nil {
-		return err
-	}
-	apk := filepath.Join(a.buildArgs.OutDir(), m.Name+".apk")
-
 	androidHome, err := build.FindAndroidHome()
 	if err != nil {
 		return err
 	}
 
-	devices, err := AndroidDevices(androidHome)
-	if err != nil {
-		return err
-	}
-	if len(devices) == 0 {
-		return errors.New("no android devices found")
+	if a.avd != "" {
+		if a.device != "" || a.all {
+			return errors.New("-avd can't be used with -device or -all")
+		}
+		a.device, err = StartEmulator(androidHome, a.avd, a.noWindow, defaultBootTimeout)
+		if err != nil {
+			return err
+		}
 	}
 
-	fmt.Printf("Connecting to %s...\n", devices[0])
-	adb, err := NewADB(androidHome, devices[0])
+	devices, err := selectDevices(androidHome, a.device, a.all)
 	if err != nil {
 		return err
 	}
-
-	if pid, err := adb.RunAs(m.AppID, "pidof", "gdbserver"); err == nil {
-		adb.RunAs(m.AppID, "kill", pid)
+	if len(devices) > 1 && a.wait {
+		return errors.New("-wait can only be used with a single device")
 	}
-	if pid, err := adb.RunAs(m.AppID, "pidof", m.AppID); err == nil {
-		adb.RunAs(m.AppID, "kill", pid)
-	}
-	adb.Uninstall(m.AppID)
-	if err := adb.Install(apk, true); err != nil {
-		return err
-	}
-
-	if !a.buildArgs.DebugBuild() {
-		_, err := adb.Shell("am", "start", fmt.Sprintf("%s/%s", m.AppID, mainActivity))
+	if err := a.buildArgs.SetABIs(deviceABIs(devices)); err != nil {
 		return err
 	}
-
-	dbgDir := filepath.Join(a.buildArgs.OutDir(), "dbg")
-	os.MkdirAll(dbgDir, 0755)
-	dataDir, err := adb.RunAs(m.AppID, "pwd")
+	rules, err := a.portRules()
 	if err != nil {
 		return err
 	}
-	adb.RunAs(m.AppID, "chmod", "a+x", dataDir)
-
-	if err := installGDBServer(dbgDir, dataDir, m.AppID, adb); err != nil {
+	if err := checkDeviceRules(rules, len(devices)); err != nil {
 		return err
 	}
-	if err := adb.Pull("/system/bin/app_process", dbgDir); err != nil {
+	// check the launch arguments before building
+	if _, err := a.launchArgs(m, false); err != nil {
 		return err
 	}
 
-	intent := fmt.Sprintf("%s/%s", m.AppID, mainActivity)
-	fmt.Printf("Launching activity %s...\n", intent)
-	if _, err := adb.Shell("am", "start", "-W", intent); err != nil {
+	fmt.Printf("Building package %s...\n", m.Name)
+	a.buildArgs.WaitDebugger(a.wait)
+	if err := build.BuildAndroid(m, a.buildArgs); err != nil {
 		return err
 	}
+	apk := a.buildArgs.APK(m)
+	a.checkBackend(os.Stdout)
 
-	pid, err := adb.RunAs(m.AppID, "pidof", m.AppID)
-	if err != nil {
-		return err
+	if len(devices) > 1 {
+		return runDevices(androidHome, m, a, apk, devices, rules)
 	}
 
-	debugSocket := path.Join(dataDir, "debug.sock")
-	adb.RunAs(m.AppID, "rm", debugSocket)
-
-	if err := adb.Forward("tcp:5039", "localfilesystem:"+debugSocket); err != nil {
-		return err
-	}
-	fmt.Printf("Starting gdbserver...\n")
-	if _, err := adb.RunAs(m.AppID, path.Join(dataDir, "gdbserver"), "--once", "--attach", "+"+debugSocket, pid); err != nil {
+	d := devices[0]
+	serial := d.Serial
+	fmt.Printf("Connecting to %s...\n", serial)
+	adb, err := NewADB(androidHome, serial)
+	if err != nil {
 		return err
 	}
-	return adb.ForwardRemove("tcp:5039")
-}
-
-func installGDBServer(localFolder, remoteFolder, appID string, adb *ADB) error {
-	localGDB := filepath.Join(localFolder, "gdbserver")
-	if _, err := os.Stat(localGDB); errors.Is(err, os.ErrNotExist) {
-		abi, err := adb.GetProp("ro.product.cpu.abi")
-		if err != nil {
-			return err
-		}
-		arch := abiToArch(abi)
-		if err := fetchGDBServer(arch, localGDB); err != nil {
-			return err
-		}
-	}
-
-	if err := adb.Push(localGDB, "/data/local/tmp/gdbserver"); err != nil {
+	if err := deploy(os.Stdout, adb, m, a, apk, d); err != nil {
 		return err
 	}
-	if _, err := adb.RunAs(appID, "cp", "/data/local/tmp/gdbserver", remoteFolder); err != nil {
+	removePorts, err := setupPorts(os.Stdout, adb, rules)
+	if err != nil {
 		return err
 	}
-	if _, err := adb.RunAs(appID, "chmod", "+x", path.Join(remoteFolder, "gdbserver")); err != nil {
-		return err
+	// the mappings outlive a detached session on purpose, so that the app
+	// keeps reaching the workstation
+	if !a.detach {
+		defer removePorts()
 	}
-	return nil
-}
 
-func abiToArch(abi string) string {
-	switch abi {
-	case "arm64-v8a":
-		return "aarch64"
-	case "armeabi-v7a":
-		return "arm"
-	case "x86":
-		return "i686"
-	case "x86_64":
-		return "x86_64"
-	default:
-		return ""
-	}
-}
+	since, _ := deviceTime(adb)
+	lc := newLogcat(os.Stdout, m.AppID, isTerminal(os.Stdout))
 
-func fetchGDBServer(arch, path string) error {
-	url := fmt.Sprintf("https://github.com/gni-dev/tools/releases/latest/download/gdbserver-%s-android.zip", arch)
-	resp, err := http.Get(url)
+	launch, err := a.launchArgs(m, false)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
+	fmt.Printf("Launching %s...\n", m.AppID)
+	if _, err := adb.Shell(launch...); err != nil {
 		return err
 	}
-
-	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
-	if err != nil {
-		return err
+	if a.wait {
+		fmt.Printf("%s waits for a debugger, attach it with gni debug android -attach\n", m.AppID)
 	}
-
-	if len(archive.File) != 1 || archive.File[0].Name != "gdbserver" {
-		return fmt.Errorf("unexpected archive %s", url)
+	if a.detach {
+		return nil
 	}
-	f := archive.File[0]
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return streamLogcat(ctx, adb, lc, since)
+}
 
-	dstFile, err := os.Create(path)
+// deploy stops the app on the device and installs apk if it changed.
+func deploy(out io.Writer, adb *ADB, m build.Metadata, a *Args, apk string, d Device) error {
+	killAll(adb, m.AppID, "lldb-server")
+	killAll(adb, m.AppID, m.AppID)
+	deployed, err := installIfChanged(out, adb, m, a, apk, d)
 	if err != nil {
 		return err
 	}
-	defer dstFile.Close()
-
-	arcFile, err := f.Open()
-	if err != nil {
+	if !deployed {
+		_, err := adb.Shell("am", "force-stop", m.AppID)
 		return err
 	}
-	defer arcFile.Close()
+	hookCtx := build.NewHookContext(m, a.buildArgs, apk)
+	hookCtx.Device = d.Serial
+	return a.buildArgs.RunHook(build.HookPostInstall, hookCtx)
+}
 
-	if _, err := io.Copy(dstFile, arcFile); err != nil {
-		return err
-	}
-	return nil
+// installAPK upgrades the app in place so it keeps its data. If the
+// installed app is signed with another key, or clean is set, the app is
+// uninstalled first.
+func installAPK(out io.Writer, adb *ADB, appID, apk string, clean bool) error {
+	if clean {
+		adb.Uninstall(appID)
+		return adb.Install(apk, false)
+	}
+	err := adb.Install(apk, true)
+	if err != nil && strings.Contains(err.Error(), "INSTALL_FAILED_UPDATE_INCOMPATIBLE") {
+		fmt.Fprintf(out, "Installed %s has a different signature, reinstalling...\n", appID)
+		adb.Uninstall(appID)
+		err = adb.Install(apk, false)
+	}
+	return err
 }
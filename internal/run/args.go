@@ -9,11 +9,43 @@ import (
 type Args struct {
 	buildArgs *build.Args
 
-	wait bool
+	wait   bool
+	clean  bool
+	device string
+	all    bool
+	detach bool
+
+	avd      string
+	noWindow bool
+
+	reverse stringList
+	forward stringList
+
+	appArgs      []string
+	env          stringList
+	stringExtras stringList
+	intExtras    stringList
+	data         string
+
+	// libOverride tells whether the built app loads overrideLib, set
+	// once built.
+	libOverride bool
 }
 
 func CreateArgs(f *flag.FlagSet) *Args {
 	a := &Args{buildArgs: build.CreateArgs(f)}
 	f.BoolVar(&a.wait, "wait", false, "Wait for the SIGCONT signal before running the app")
+	f.StringVar(&a.device, "device", "", "Comma-separated serials of the devices to run on. Default is $ANDROID_SERIAL")
+	f.BoolVar(&a.all, "all", false, "Run on all attached devices")
+	f.BoolVar(&a.clean, "clean", false, "Uninstall the app before installing to start with fresh data")
+	f.BoolVar(&a.detach, "detach", false, "Exit after launching the app instead of streaming its logs. Port mappings are left in place")
+	f.StringVar(&a.avd, "avd", "", "Android virtual device to start, unless running, and run on")
+	f.BoolVar(&a.noWindow, "no-window", false, "Start the emulator of -avd headless")
+	f.Var(&a.reverse, "reverse", "Map a device port to a workstation port, like \"8080\" or \"tcp:8080 tcp:9000\". Can be repeated")
+	f.Var(&a.forward, "forward", "Map a workstation port to a device port, like \"9222\" or \"tcp:9222 localabstract:app\". Can be repeated, with a single device")
+	f.Var(&a.env, "env", "Environment variable KEY=VALUE of the app. Can be repeated")
+	f.Var(&a.stringExtras, "es", "String intent extra KEY=VALUE. Can be repeated")
+	f.Var(&a.intExtras, "ei", "Integer intent extra KEY=VALUE. Can be repeated")
+	f.StringVar(&a.data, "data", "", "Data URI of the launch intent, for deep links")
 	return a
 }
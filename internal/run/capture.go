@@ -0,0 +1,178 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gni.dev/cmd/internal/build"
+)
+
+// maxRecordDuration is the time limit of screenrecord.
+const maxRecordDuration = 3 * time.Minute
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type captureArgs struct {
+	buildArgs *build.Args
+	device    string
+	dir       string
+	duration  time.Duration
+}
+
+// parseCaptureArgs parses the flags of the screenshot and record commands
+// and returns the metadata of the app.
+func parseCaptureArgs(name string, args []string) (*captureArgs, build.Metadata) {
+	f := flag.NewFlagSet(name, flag.ExitOnError)
+	a := &captureArgs{buildArgs: build.CreateArgs(f)}
+	f.StringVar(&a.device, "device", "", "Serial of the device. Default is $ANDROID_SERIAL")
+	f.StringVar(&a.dir, "dir", ".", "Directory to save the file to")
+	if name == "record" {
+		f.DurationVar(&a.duration, "duration", 10*time.Second, "Duration of the recording, up to 3m")
+	}
+	if err := f.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	dir, err := filepath.Abs(a.dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	a.dir = dir
+
+	if a.buildArgs.Chdir() != "." {
+		if err := os.Chdir(a.buildArgs.Chdir()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	_, m, err := appMetadata(a.buildArgs, f.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return a, m
+}
+
+// captureFile returns the path of a capture of the app taken now.
+func (a *captureArgs) captureFile(m build.Metadata, ext string) string {
+	name := fmt.Sprintf("%s-%s-%s.%s", m.AppID, fileNamePart(m.Version), time.Now().Format("20060102-150405"), ext)
+	return filepath.Join(a.dir, name)
+}
+
+// fileNamePart replaces the characters of s which may not be safe in a file
+// name, like the / of a version such as 1.2-feature/x, with _.
+func fileNamePart(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '+':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func (a *captureArgs) adb() (*ADB, error) {
+	androidHome, err := build.FindAndroidHome()
+	if err != nil {
+		return nil, err
+	}
+	d, err := selectDevice(androidHome, a.device)
+	if err != nil {
+		return nil, err
+	}
+	return NewADB(androidHome, d.Serial)
+}
+
+// Screenshot saves a screenshot of the device.
+func Screenshot(args []string) {
+	a, m := parseCaptureArgs("screenshot", args)
+	if err := screenshot(a, m); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func screenshot(a *captureArgs, m build.Metadata) error {
+	adb, err := a.adb()
+	if err != nil {
+		return err
+	}
+	var png bytes.Buffer
+	if err := adb.execOut(&png, "screencap", "-p"); err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(png.Bytes(), pngSignature) {
+		return fmt.Errorf("screencap failed: %s", bytes.TrimSpace(png.Bytes()))
+	}
+	file := a.captureFile(m, "png")
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, png.Bytes(), 0644); err != nil {
+		return err
+	}
+	fmt.Println("Saved", file)
+	return nil
+}
+
+// Record saves a screen recording of the device.
+func Record(args []string) {
+	a, m := parseCaptureArgs("record", args)
+	if err := record(a, m); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func record(a *captureArgs, m build.Metadata) error {
+	if a.duration <= 0 || a.duration > maxRecordDuration {
+		return fmt.Errorf("duration must be between 1s and %s", maxRecordDuration)
+	}
+	adb, err := a.adb()
+	if err != nil {
+		return err
+	}
+
+	// Ctrl-C stops the recording early, screenrecord finalizes the file on
+	// SIGINT.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			adb.Shell("pkill", "-INT", "screenrecord")
+		case <-done:
+		}
+	}()
+
+	file := a.captureFile(m, "mp4")
+	remote := "/data/local/tmp/gni-record.mp4"
+	secs := int((a.duration + time.Second - 1) / time.Second)
+	fmt.Printf("Recording for %s, press Ctrl-C to stop...\n", a.duration)
+	if _, err := adb.Shell("screenrecord", "--time-limit", strconv.Itoa(secs), remote); err != nil && ctx.Err() == nil {
+		return err
+	}
+	defer adb.Shell("rm", "-f", remote)
+
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return err
+	}
+	if err := adb.Pull(remote, file); err != nil {
+		return err
+	}
+	fmt.Println("Saved", file)
+	return nil
+}
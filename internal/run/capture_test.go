@@ -0,0 +1,30 @@
+package run
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gni.dev/cmd/internal/build"
+)
+
+func TestCaptureFile(t *testing.T) {
+	a := &captureArgs{dir: "captures"}
+	tests := []struct {
+		version string
+		prefix  string
+	}{
+		{"1.2.3", "dev.gni.app-1.2.3-"},
+		{"1.2-4-gdeadbee-dirty", "dev.gni.app-1.2-4-gdeadbee-dirty-"},
+		{"feature/x", "dev.gni.app-feature_x-"},
+		{`..\..\x`, "dev.gni.app-.._.._x-"},
+		{"1.0 beta:2", "dev.gni.app-1.0_beta_2-"},
+	}
+	for _, test := range tests {
+		file := a.captureFile(build.Metadata{AppID: "dev.gni.app", Version: test.version}, "png")
+		assert.Equal(t, "captures", filepath.Dir(file), test.version)
+		assert.True(t, strings.HasPrefix(filepath.Base(file), test.prefix), "%s: %s", test.version, file)
+		assert.True(t, strings.HasSuffix(file, ".png"), test.version)
+	}
+}
@@ -0,0 +1,320 @@
+package run
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"gni.dev/cmd/internal/build"
+)
+
+// Data copies the private data of a debuggable app from and to the device.
+func Data(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Please specify command (pull, push, clear)")
+		os.Exit(1)
+	}
+	command := args[0]
+
+	dataFlags := flag.NewFlagSet("data "+command, flag.ExitOnError)
+	buildArgs := build.CreateArgs(dataFlags)
+	device := dataFlags.String("device", "", "Serial of the device. Default is $ANDROID_SERIAL")
+	var clear bool
+	if command == "push" {
+		dataFlags.BoolVar(&clear, "clear", false, "Clear the app data before pushing")
+	}
+	if err := dataFlags.Parse(args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	patterns := dataFlags.Args()
+	dir := ""
+	switch command {
+	case "pull", "push":
+		if len(patterns) < 1 {
+			fmt.Fprintf(os.Stderr, "Please specify the directory to %s\n", command)
+			os.Exit(1)
+		}
+		dir, patterns = patterns[0], patterns[1:]
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+	case "clear":
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown command:", command)
+		os.Exit(1)
+	}
+
+	if buildArgs.Chdir() != "." {
+		if err := os.Chdir(buildArgs.Chdir()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	_, m, err := appMetadata(buildArgs, patterns)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := runData(command, m.AppID, *device, dir, clear); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runData(command, appID, serial, dir string, clear bool) error {
+	androidHome, err := build.FindAndroidHome()
+	if err != nil {
+		return err
+	}
+	d, err := selectDevice(androidHome, serial)
+	if err != nil {
+		return err
+	}
+	adb, err := NewADB(androidHome, d.Serial)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch command {
+	case "pull":
+		fmt.Printf("Pulling data of %s to %s...\n", appID, dir)
+		return pullData(ctx, adb, appID, dir)
+	case "push":
+		if _, err := adb.Shell("am", "force-stop", appID); err != nil {
+			return err
+		}
+		if clear {
+			if err := clearData(adb, appID); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Pushing %s to data of %s...\n", dir, appID)
+		return pushData(ctx, adb, appID, dir)
+	default:
+		fmt.Printf("Clearing data of %s...\n", appID)
+		return clearData(adb, appID)
+	}
+}
+
+func appDataDir(appID string) string {
+	return "/data/data/" + appID
+}
+
+// pullData copies the data dir of the app into dir with a tar archive
+// made by the app user.
+func pullData(ctx context.Context, adb *ADB, appID, dir string) error {
+	if err := adb.needShellV2("gni data pull"); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	var stderr bytes.Buffer
+	errc := make(chan error, 1)
+	go func() {
+		code, err := adb.shell(ctx, nil, pw, &stderr, "run-as", appID, "tar", "-cf", "-", "-C", appDataDir(appID), ".")
+		if err == nil && code != 0 {
+			err = runAsError(appID, code, stderr.String())
+		}
+		pw.CloseWithError(err)
+		errc <- err
+	}()
+
+	extractErr := extractTar(pr, dir)
+	// closing the pipe makes the shell fail, the cause is extractErr
+	pr.Close()
+	err := <-errc
+	if extractErr != nil {
+		return extractErr
+	}
+	return err
+}
+
+// pushData copies the content of dir into the data dir of the app, as the
+// app user so that the files belong to the app.
+func pushData(ctx context.Context, adb *ADB, appID, dir string) error {
+	if err := adb.needShellV2("gni data push"); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(dir); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTar(pw, dir))
+	}()
+	defer pr.Close()
+
+	var out bytes.Buffer
+	code, err := adb.shell(ctx, pr, &out, &out, "run-as", appID, "tar", "-xf", "-", "-C", appDataDir(appID))
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return runAsError(appID, code, out.String())
+	}
+	return nil
+}
+
+func clearData(adb *ADB, appID string) error {
+	out, err := adb.Shell("pm", "clear", appID)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(out, "Success") {
+		return fmt.Errorf("failed to clear data of %s: %s", appID, out)
+	}
+	return nil
+}
+
+func runAsError(appID string, code int, out string) error {
+	out = strings.TrimSpace(out)
+	if strings.Contains(out, "not debuggable") {
+		return fmt.Errorf("%s must be a debug build to access its data: %s", appID, out)
+	}
+	return fmt.Errorf("run-as %s failed with exit status %d: %s", appID, code, out)
+}
+
+// extractTar extracts the tar stream r into dir. Entries escaping dir are
+// rejected. Symbolic links are skipped: they point to device paths like the
+// native library dir, and could make later entries escape dir.
+func extractTar(r io.Reader, dir string) error {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if name == "." {
+			continue
+		}
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path %s in data archive", hdr.Name)
+		}
+		target := filepath.Join(root, name)
+		mode := os.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := checkInside(root, target); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(target, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := checkInside(root, filepath.Dir(target)); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			// don't write through a link left by a previous pull
+			if fi, err := os.Lstat(target); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+				if err := os.Remove(target); err != nil {
+					return err
+				}
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode|0600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		}
+	}
+}
+
+// checkInside fails if dir, once symbolic links are resolved, is not in
+// root. If dir doesn't exist, its closest existing parent is checked.
+func checkInside(root, dir string) error {
+	resolved, err := filepath.EvalSymlinks(dir)
+	for errors.Is(err, os.ErrNotExist) && dir != root {
+		dir = filepath.Dir(dir)
+		resolved, err = filepath.EvalSymlinks(dir)
+	}
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside of %s", dir, root)
+	}
+	return nil
+}
+
+// writeTar writes the content of dir as a tar stream to w. Symbolic links
+// are left out as they point to device paths like the native library dir.
+func writeTar(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if !fi.Mode().IsRegular() && !fi.IsDir() {
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		// the device has no users of the host
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
@@ -0,0 +1,85 @@
+package run
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataTar(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "shared_prefs"), 0o771))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "shared_prefs", "prefs.xml"), []byte("<map/>"), 0o660))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "files.db"), []byte("db"), 0o600))
+
+	var buf bytes.Buffer
+	require.NoError(t, writeTar(&buf, src))
+
+	dst := t.TempDir()
+	require.NoError(t, extractTar(&buf, dst))
+	data, err := os.ReadFile(filepath.Join(dst, "shared_prefs", "prefs.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, "<map/>", string(data))
+	data, err = os.ReadFile(filepath.Join(dst, "files.db"))
+	require.NoError(t, err)
+	assert.Equal(t, "db", string(data))
+}
+
+func TestExtractTarEscape(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0o644, Typeflag: tar.TypeReg}))
+	require.NoError(t, tw.Close())
+	assert.ErrorContains(t, extractTar(&buf, t.TempDir()), "invalid path")
+}
+
+func TestExtractTarSymlink(t *testing.T) {
+	outside := t.TempDir()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "a", Linkname: outside, Typeflag: tar.TypeSymlink}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "a/.bashrc", Mode: 0o644, Size: 4, Typeflag: tar.TypeReg}))
+	tw.Write([]byte("evil"))
+	require.NoError(t, tw.Close())
+
+	dst := t.TempDir()
+	require.NoError(t, extractTar(&buf, dst))
+	assert.NoFileExists(t, filepath.Join(outside, ".bashrc"))
+	fi, err := os.Lstat(filepath.Join(dst, "a"))
+	require.NoError(t, err)
+	assert.True(t, fi.IsDir())
+}
+
+func TestExtractTarExistingLink(t *testing.T) {
+	outside := t.TempDir()
+	dst := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(dst, "a")))
+
+	for _, name := range []string{"a/b/c/file", "a/file"} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Typeflag: tar.TypeReg}))
+		require.NoError(t, tw.Close())
+		assert.ErrorContains(t, extractTar(&buf, dst), "outside of", name)
+	}
+	entries, err := os.ReadDir(outside)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestPullDataExtractError(t *testing.T) {
+	s := newFakeADB(t)
+	s.shell = func(cmd string) (string, int) {
+		return strings.Repeat("not a tar archive", 1024), 0
+	}
+	a := &ADB{addr: s.l.Addr().String(), serial: "emulator-5554"}
+	err := pullData(context.Background(), a, "dev.gni.app", t.TempDir())
+	assert.ErrorIs(t, err, tar.ErrHeader)
+}
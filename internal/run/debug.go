@@ -0,0 +1,422 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"gni.dev/cmd/internal/build"
+	"gni.dev/cmd/internal/dbg"
+	"gni.dev/cmd/internal/dbg/lldb"
+)
+
+// sigCONT is SIGCONT on Android, whatever the host.
+const sigCONT = syscall.Signal(0x12)
+
+func init() {
+	dbg.Android = DebugAndroid
+}
+
+// androidDebugger is an lldb-server attached to the app on a device.
+type androidDebugger struct {
+	*lldb.LLDB
+	adb   *ADB
+	appID string
+	pid   string
+	port  string
+	stop  context.CancelFunc
+	// mu guards resumed, as Detach may be called while Continue runs.
+	mu      sync.Mutex
+	resumed bool
+}
+
+// resume sends SIGCONT to the app if it still waits for it.
+func (d *androidDebugger) resume() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.resumed {
+		return nil
+	}
+	if _, err := d.adb.RunAs(d.appID, "kill", "-CONT", d.pid); err != nil {
+		return err
+	}
+	d.resumed = true
+	return nil
+}
+
+func (d *androidDebugger) Run(program string, args []string) error {
+	return errors.New("the app is already running")
+}
+
+// Continue resumes the app, which waits for SIGCONT the first time.
+func (d *androidDebugger) Continue() error {
+	if err := d.resume(); err != nil {
+		return err
+	}
+	return d.LLDB.Continue()
+}
+
+// Detach leaves the app running. An app still waiting for SIGCONT gets it
+// first, as nothing would send it once detached.
+func (d *androidDebugger) Detach() error {
+	err := d.resume()
+	if rerr := d.Release(); err == nil {
+		err = rerr
+	}
+	if derr := d.LLDB.Detach(); err == nil {
+		err = derr
+	}
+	d.adb.ForwardRemove("tcp:" + d.port)
+	d.stop()
+	return err
+}
+
+// DebugAndroid builds the app matching args in debug mode, launches it on
+// the device waiting for a debugger and attaches lldb-server to it.
+// Progress is written to out.
+func DebugAndroid(args []string, out io.Writer) (dbg.Debugger, error) {
+	dbgFlags := flag.NewFlagSet("debug android", flag.ExitOnError)
+	a := CreateArgs(dbgFlags)
+	attach := dbgFlags.Bool("attach", false, "Attach to the running app instead of building and launching it")
+	args, a.appArgs = splitAppArgs(args)
+	if err := dbgFlags.Parse(args); err != nil {
+		return nil, err
+	}
+	if a.buildArgs.Chdir() != "." {
+		if err := os.Chdir(a.buildArgs.Chdir()); err != nil {
+			return nil, err
+		}
+	}
+	a.buildArgs.SetDebugBuild(true)
+	buildArgs, m, err := appMetadata(a.buildArgs, dbgFlags.Args())
+	if err != nil {
+		return nil, err
+	}
+	a.buildArgs = buildArgs
+
+	androidHome, err := build.FindAndroidHome()
+	if err != nil {
+		return nil, err
+	}
+	d, err := selectDevice(androidHome, a.device)
+	if err != nil {
+		return nil, err
+	}
+	if *attach {
+		return attachAndroid(out, androidHome, m, a, d)
+	}
+	if err := a.buildArgs.SetABIs([]string{d.ABI}); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(out, "Building package %s...\n", m.Name)
+	a.buildArgs.WaitDebugger(true)
+	if err := build.BuildAndroid(m, a.buildArgs); err != nil {
+		return nil, err
+	}
+	apk := a.buildArgs.APK(m)
+	a.checkBackend(out)
+
+	adb, err := NewADB(androidHome, d.Serial)
+	if err != nil {
+		return nil, err
+	}
+	if err := deploy(out, adb, m, a, apk, d); err != nil {
+		return nil, err
+	}
+	launch, err := a.launchArgs(m, true)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(out, "Launching %s...\n", m.AppID)
+	if _, err := adb.Shell(launch...); err != nil {
+		return nil, err
+	}
+	pid, err := adb.Shell("pidof", m.AppID)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not running: %w", m.AppID, err)
+	}
+
+	lib, ok := build.NativeLibs(a.buildArgs)[d.ABI]
+	if !ok {
+		return nil, fmt.Errorf("no library built for %s", d.ABI)
+	}
+	return attachLLDB(out, adb, androidHome, m.AppID, d.ABI, pid, lib, true)
+}
+
+// attachAndroid attaches to the running app, using the symbols of its
+// library from the local build output.
+func attachAndroid(out io.Writer, androidHome string, m build.Metadata, a *Args, d Device) (dbg.Debugger, error) {
+	adb, err := NewADB(androidHome, d.Serial)
+	if err != nil {
+		return nil, err
+	}
+	pid, err := adb.Shell("pidof", m.AppID)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not running on %s", m.AppID, d.Serial)
+	}
+	if pids := strings.Fields(pid); len(pids) > 1 {
+		return nil, fmt.Errorf("%s has several processes: %s", m.AppID, pid)
+	}
+	killAll(adb, m.AppID, "lldb-server")
+
+	lib, err := runningLibSymbols(adb, a.buildArgs, m.AppID, pid)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(out, "Using symbols from %s\n", lib)
+	// an app started by gni run -wait is stopped until it gets SIGCONT,
+	// which must not reach an app running normally
+	stat, err := adb.RunAs(m.AppID, "cat", "/proc/"+pid+"/stat")
+	if err != nil {
+		return nil, err
+	}
+	return attachLLDB(out, adb, androidHome, m.AppID, d.ABI, pid, lib, procStopped(stat))
+}
+
+// procStopped tells whether /proc/pid/stat reports a process stopped by a
+// signal.
+func procStopped(stat string) bool {
+	// 1234 (app name) T 567 ...: the name may hold spaces and parentheses
+	i := strings.LastIndexByte(stat, ')')
+	if i < 0 {
+		return false
+	}
+	fields := strings.Fields(stat[i+1:])
+	return len(fields) > 0 && fields[0] == "T"
+}
+
+// runningLibSymbols returns the unstripped copy of the libgni.so loaded by
+// the process, looked up by build-id in the local build output.
+func runningLibSymbols(adb *ADB, a *build.Args, appID, pid string) (string, error) {
+	maps, err := adb.RunAs(appID, "cat", "/proc/"+pid+"/maps")
+	if err != nil {
+		return "", err
+	}
+	_, remote, ok := mapStart(maps, "libgni.so")
+	if !ok {
+		return "", fmt.Errorf("libgni.so is not loaded by process %s", pid)
+	}
+
+	tmp, err := os.MkdirTemp("", "gni-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	local := filepath.Join(tmp, "libgni.so")
+	// the library may only be readable by the app, as in code_cache
+	if err := adb.needShellV2("reading " + remote); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	code, err := adb.shell(context.Background(), nil, &buf, io.Discard, "run-as", appID, "cat", remote)
+	if err != nil {
+		return "", err
+	}
+	if code != 0 {
+		return "", fmt.Errorf("failed to read %s", remote)
+	}
+	if err := os.WriteFile(local, buf.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	id, err := build.ReadBuildID(local)
+	if err != nil {
+		return "", err
+	}
+
+	if sym := build.SymbolFile(a.SymbolsDir(), id); fileExists(sym) {
+		return sym, nil
+	}
+	return build.FindSymbols(a.OutRoot(), id)
+}
+
+// killAll kills the processes of the app user running name.
+func killAll(adb *ADB, appID, name string) {
+	out, err := adb.RunAs(appID, "pidof", name)
+	if err != nil {
+		return
+	}
+	if pids := strings.Fields(out); len(pids) > 0 {
+		adb.RunAs(appID, append([]string{"kill"}, pids...)...)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// attachLLDB starts lldb-server on the device attached to the process pid
+// of the app, and connects to it through an adb forward. lib is the local
+// copy of the library to debug. waiting tells whether the app waits for
+// SIGCONT before running.
+func attachLLDB(out io.Writer, adb *ADB, androidHome, appID, abi, pid, lib string, waiting bool) (dbg.Debugger, error) {
+	dataDir, err := adb.RunAs(appID, "pwd")
+	if err != nil {
+		return nil, err
+	}
+	server, err := installLLDBServer(adb, androidHome, appID, abi, dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	sock := path.Join("/", appID, "debug.sock")
+	ctx, stop := context.WithCancel(context.Background())
+	fmt.Fprintf(out, "Starting lldb-server...\n")
+	go func() {
+		code, err := adb.shell(ctx, nil, out, out, "run-as", appID, server, "gdbserver", "unix-abstract://"+sock, "--attach", pid)
+		if ctx.Err() == nil && (err != nil || code != 0) {
+			fmt.Fprintf(out, "lldb-server exited: status %d %v\n", code, err)
+		}
+	}()
+
+	port, err := freePort()
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	if err := adb.Forward("tcp:"+port, "localabstract:"+sock); err != nil {
+		stop()
+		return nil, err
+	}
+	d := &androidDebugger{adb: adb, appID: appID, pid: pid, port: port, resumed: !waiting, stop: stop}
+
+	d.LLDB, err = lldb.Connect("tcp", net.JoinHostPort("localhost", port))
+	if err != nil {
+		adb.ForwardRemove("tcp:" + port)
+		stop()
+		return nil, fmt.Errorf("failed to connect to lldb-server: %w", err)
+	}
+	// the app waits for SIGCONT, which must reach it
+	if err := d.PassSignals(sigCONT); err != nil {
+		d.Detach()
+		return nil, err
+	}
+	bias, err := loadBias(adb, appID, pid, lib)
+	if err != nil {
+		d.Detach()
+		return nil, err
+	}
+	if err := d.LoadSymbols(lib, bias); err != nil {
+		d.Detach()
+		return nil, err
+	}
+	fmt.Fprintf(out, "Attached to %s (pid %s)\n", appID, pid)
+	return d, nil
+}
+
+// installLLDBServer copies the lldb-server of the NDK for abi into the data
+// dir of the app and returns its path on the device.
+func installLLDBServer(adb *ADB, androidHome, appID, abi, dataDir string) (string, error) {
+	local, err := findLLDBServer(androidHome, abi)
+	if err != nil {
+		return "", err
+	}
+	tmp := "/data/local/tmp/lldb-server"
+	if err := adb.Push(local, tmp); err != nil {
+		return "", err
+	}
+	server := path.Join(dataDir, "lldb-server")
+	if _, err := adb.RunAs(appID, "cp", tmp, server); err != nil {
+		return "", err
+	}
+	if _, err := adb.RunAs(appID, "chmod", "700", server); err != nil {
+		return "", err
+	}
+	return server, nil
+}
+
+// findLLDBServer returns the lldb-server of the NDK for the Android ABI.
+func findLLDBServer(androidHome, abi string) (string, error) {
+	arch, ok := map[string]string{
+		"arm64-v8a":   "aarch64",
+		"armeabi-v7a": "arm",
+		"x86":         "i386",
+		"x86_64":      "x86_64",
+	}[abi]
+	if !ok {
+		return "", fmt.Errorf("unsupported ABI %s", abi)
+	}
+	ndkRoot, err := build.FindNDK(androidHome)
+	if err != nil {
+		return "", err
+	}
+	matches, err := filepath.Glob(filepath.Join(ndkRoot, "toolchains", "llvm", "prebuilt", "*", "lib*", "clang", "*", "lib", "linux", arch, "lldb-server"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no lldb-server for %s found in %s", abi, ndkRoot)
+	}
+	sort.Strings(matches)
+	return matches[len(matches)-1], nil
+}
+
+func freePort() (string, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port), nil
+}
+
+// loadBias returns the difference between the addresses of lib in the
+// process and its link-time addresses.
+func loadBias(adb *ADB, appID, pid, lib string) (uint64, error) {
+	maps, err := adb.RunAs(appID, "cat", "/proc/"+pid+"/maps")
+	if err != nil {
+		return 0, err
+	}
+	start, _, ok := mapStart(maps, filepath.Base(lib))
+	if !ok {
+		return 0, fmt.Errorf("%s is not loaded by process %s", filepath.Base(lib), pid)
+	}
+
+	f, err := elf.Open(lib)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD {
+			return start - (p.Vaddr - p.Off), nil
+		}
+	}
+	return 0, fmt.Errorf("%s has no loadable segment", lib)
+}
+
+// mapStart returns the start address and the path of the mapping of the
+// beginning of the file name in the content of /proc/pid/maps.
+func mapStart(maps, name string) (uint64, string, bool) {
+	for _, l := range strings.Split(maps, "\n") {
+		// 7a1c2e000-7a1c30000 r--p 00000000 fe:2b 1234  /data/app/.../libgni.so
+		fields := strings.Fields(l)
+		if len(fields) < 6 || path.Base(fields[len(fields)-1]) != name {
+			continue
+		}
+		if off, err := strconv.ParseUint(fields[2], 16, 64); err != nil || off != 0 {
+			continue
+		}
+		addrs := strings.SplitN(fields[0], "-", 2)
+		start, err := strconv.ParseUint(addrs[0], 16, 64)
+		if err != nil {
+			continue
+		}
+		return start, fields[len(fields)-1], true
+	}
+	return 0, "", false
+}
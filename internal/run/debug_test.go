@@ -0,0 +1,58 @@
+package run
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapStart(t *testing.T) {
+	maps := `6f8a1000-6f8a2000 r--p 00000000 fe:00 1201  /system/lib64/libc.so
+7a1c2e000-7a1c30000 r--p 00001000 fe:2b 1234  /data/app/~~a==/dev.gni.app-b==/lib/arm64/libgni.so
+7a1c30000-7a1c90000 r--p 00000000 fe:2b 1234  /data/app/~~a==/dev.gni.app-b==/lib/arm64/libgni.so
+7a1c90000-7a1d00000 r-xp 00060000 fe:2b 1234  /data/app/~~a==/dev.gni.app-b==/lib/arm64/libgni.so
+7b0000000-7b0001000 rw-p 00000000 00:00 0 
+`
+	start, path, ok := mapStart(maps, "libgni.so")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0x7a1c30000), start)
+	assert.Equal(t, "/data/app/~~a==/dev.gni.app-b==/lib/arm64/libgni.so", path)
+	_, _, ok = mapStart(maps, "libfoo.so")
+	assert.False(t, ok)
+}
+
+func TestKillAll(t *testing.T) {
+	s := newFakeADB(t)
+	var cmds []string
+	s.shell = func(cmd string) (string, int) {
+		cmds = append(cmds, cmd)
+		if strings.HasSuffix(cmd, "pidof lldb-server") {
+			return "1234 5678\n", 0
+		}
+		return "", 0
+	}
+	adb := &ADB{addr: s.l.Addr().String(), serial: "emulator-5554"}
+	killAll(adb, "dev.gni.app", "lldb-server")
+	assert.Equal(t, []string{
+		"run-as dev.gni.app pidof lldb-server",
+		"run-as dev.gni.app kill 1234 5678",
+	}, cmds)
+}
+
+func TestProcStopped(t *testing.T) {
+	tests := []struct {
+		stat    string
+		stopped bool
+	}{
+		{"1234 (dev.gni.app) T 567 567 0 0 -1 1077952832 2573 0\n", true},
+		{"1234 (dev.gni.app) S 567 567 0 0 -1 1077952832 2573 0\n", false},
+		{"1234 (dev.gni.app) t 567 567 0 0 -1 1077952832 2573 0\n", false},
+		{"1234 (a) T (b) S 567 567 0\n", false},
+		{"1234 (a) S (b) T 567 567 0\n", true},
+		{"", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.stopped, procStopped(test.stat), test.stat)
+	}
+}
@@ -0,0 +1,145 @@
+package run
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// selectDevices returns the devices to run on: all ready devices with all,
+// else the devices of the comma-separated list of serials, else the one
+// chosen by selectDevice.
+func selectDevices(androidHome, serials string, all bool) ([]Device, error) {
+	if !all && !strings.Contains(serials, ",") {
+		d, err := selectDevice(androidHome, serials)
+		if err != nil {
+			return nil, err
+		}
+		return []Device{d}, nil
+	}
+
+	devices, err := ListDevices(androidHome)
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		var ready []Device
+		for _, d := range devices {
+			if d.Ready() {
+				ready = append(ready, d)
+			}
+		}
+		if len(ready) == 0 {
+			return nil, errors.New("no android devices found, attach one or start an emulator with -avd")
+		}
+		return ready, nil
+	}
+
+	var selected []Device
+	for _, serial := range strings.Split(serials, ",") {
+		serial = strings.TrimSpace(serial)
+		if serial == "" {
+			continue
+		}
+		d, err := findDevice(devices, serial)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, d)
+	}
+	return selected, nil
+}
+
+// selectDevice returns the device to use. The device is chosen by serial,
+// falling back to $ANDROID_SERIAL. Without either, the only attached device
+// is used, or the user is asked to choose one.
+func selectDevice(androidHome, serial string) (Device, error) {
+	if serial == "" {
+		serial = os.Getenv("ANDROID_SERIAL")
+	}
+
+	devices, err := ListDevices(androidHome)
+	if err != nil {
+		return Device{}, err
+	}
+
+	if serial != "" {
+		return findDevice(devices, serial)
+	}
+
+	var ready []Device
+	for _, d := range devices {
+		if d.Ready() {
+			ready = append(ready, d)
+		}
+	}
+	switch {
+	case len(ready) == 0:
+		return Device{}, errors.New("no android devices found, attach one or start an emulator with -avd")
+	case len(ready) == 1:
+		return ready[0], nil
+	case !isTerminal(os.Stdin):
+		serials := make([]string, len(ready))
+		for i, d := range ready {
+			serials[i] = d.Serial
+		}
+		return Device{}, fmt.Errorf("multiple devices found, use -device or ANDROID_SERIAL to select one of: %s", strings.Join(serials, ", "))
+	}
+	return chooseDevice(ready)
+}
+
+// findDevice returns the ready device with the given serial.
+func findDevice(devices []Device, serial string) (Device, error) {
+	for _, d := range devices {
+		if d.Serial != serial {
+			continue
+		}
+		if !d.Ready() {
+			return Device{}, fmt.Errorf("device %s is %s", serial, d.State)
+		}
+		return d, nil
+	}
+	return Device{}, fmt.Errorf("device %s not found", serial)
+}
+
+// deviceABIs returns the ABIs to build for running on devices.
+func deviceABIs(devices []Device) []string {
+	var abis []string
+	seen := map[string]bool{}
+	for _, d := range devices {
+		if d.ABI != "" && !seen[d.ABI] {
+			seen[d.ABI] = true
+			abis = append(abis, d.ABI)
+		}
+	}
+	sort.Strings(abis)
+	return abis
+}
+
+func chooseDevice(devices []Device) (Device, error) {
+	fmt.Println("Multiple devices found:")
+	for i, d := range devices {
+		fmt.Printf("  %d) %s %s (API %d, %s)\n", i+1, d.Serial, d.Model, d.API, d.ABI)
+	}
+	r := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("Choose device [1-%d]: ", len(devices))
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return Device{}, err
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(line))
+		if err == nil && n >= 1 && n <= len(devices) {
+			return devices[n-1], nil
+		}
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
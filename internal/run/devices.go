@@ -0,0 +1,51 @@
+package run
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"gni.dev/cmd/internal/build"
+)
+
+// Devices lists the attached Android devices.
+func Devices(args []string) {
+	devFlags := flag.NewFlagSet("devices", flag.ExitOnError)
+	if err := devFlags.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := listAndroidDevices(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func listAndroidDevices() error {
+	androidHome, err := build.FindAndroidHome()
+	if err != nil {
+		return err
+	}
+	devices, err := ListDevices(androidHome)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		fmt.Println("No android devices found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SERIAL\tSTATE\tMODEL\tAPI\tABI")
+	for _, d := range devices {
+		api := ""
+		if d.API > 0 {
+			api = strconv.Itoa(d.API)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.Serial, d.State, d.Model, api, d.ABI)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,403 @@
+package run
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gni.dev/cmd/internal/build"
+)
+
+// The emulator console ports are the even ports of this range, the adb
+// port of an emulator is its console port + 1.
+const (
+	firstConsolePort = 5554
+	lastConsolePort  = 5682
+)
+
+const defaultBootTimeout = 5 * time.Minute
+
+// Emulator manages the Android virtual devices.
+func Emulator(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Please specify command (list, start, stop)")
+		os.Exit(1)
+	}
+	command := args[0]
+
+	emuFlags := flag.NewFlagSet("emulator "+command, flag.ExitOnError)
+	var noWindow, all bool
+	var timeout time.Duration
+	switch command {
+	case "start":
+		emuFlags.BoolVar(&noWindow, "no-window", false, "Run the emulator headless")
+		emuFlags.DurationVar(&timeout, "timeout", defaultBootTimeout, "Time to wait for the emulator to boot")
+	case "stop":
+		emuFlags.BoolVar(&all, "all", false, "Stop all running emulators")
+	}
+	if err := emuFlags.Parse(args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	androidHome, err := build.FindAndroidHome()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	switch command {
+	case "list":
+		err = listEmulators(androidHome)
+	case "start":
+		if emuFlags.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "Please specify the AVD to start")
+			os.Exit(1)
+		}
+		_, err = StartEmulator(androidHome, emuFlags.Arg(0), noWindow, timeout)
+	case "stop":
+		err = stopEmulators(androidHome, emuFlags.Args(), all)
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown command:", command)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// runningEmulator is an emulator attached to adb.
+type runningEmulator struct {
+	serial string
+	port   int
+	avd    string
+}
+
+func findEmulator(androidHome string) (string, error) {
+	exe := "emulator"
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	emulator := filepath.Join(androidHome, "emulator", exe)
+	if _, err := os.Stat(emulator); err != nil {
+		return "", fmt.Errorf("failed to find emulator, install it with sdkmanager: %w", err)
+	}
+	return emulator, nil
+}
+
+// ListAVDs returns the names of the Android virtual devices.
+func ListAVDs(androidHome string) ([]string, error) {
+	emulator, err := findEmulator(androidHome)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(emulator, "-list-avds")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", cmd, err)
+	}
+	return parseAVDs(string(out)), nil
+}
+
+func parseAVDs(out string) []string {
+	var avds []string
+	for _, l := range strings.Split(out, "\n") {
+		l = strings.TrimSpace(l)
+		// recent emulators log INFO lines before the list
+		if l == "" || strings.HasPrefix(l, "INFO") {
+			continue
+		}
+		avds = append(avds, l)
+	}
+	return avds
+}
+
+func runningEmulators(androidHome string) ([]runningEmulator, error) {
+	devices, err := listDevices(androidHome)
+	if err != nil {
+		return nil, err
+	}
+	var emus []runningEmulator
+	for _, d := range devices {
+		port, err := strconv.Atoi(strings.TrimPrefix(d.Serial, "emulator-"))
+		if !strings.HasPrefix(d.Serial, "emulator-") || err != nil {
+			continue
+		}
+		e := runningEmulator{serial: d.Serial, port: port}
+		if c, err := dialConsole(port); err == nil {
+			e.avd, _ = c.command("avd name")
+			c.Close()
+		}
+		emus = append(emus, e)
+	}
+	return emus, nil
+}
+
+func listEmulators(androidHome string) error {
+	avds, err := ListAVDs(androidHome)
+	if err != nil {
+		return err
+	}
+	emus, err := runningEmulators(androidHome)
+	if err != nil {
+		return err
+	}
+	if len(avds) == 0 {
+		fmt.Println("No AVDs found, create one with avdmanager")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "AVD\tSERIAL")
+	for _, avd := range avds {
+		serial := ""
+		for _, e := range emus {
+			if e.avd == avd {
+				serial = e.serial
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\n", avd, serial)
+	}
+	return w.Flush()
+}
+
+// StartEmulator starts the AVD unless it is running already, waits for it
+// to boot and returns its serial.
+func StartEmulator(androidHome, avd string, noWindow bool, timeout time.Duration) (string, error) {
+	avds, err := ListAVDs(androidHome)
+	if err != nil {
+		return "", err
+	}
+	found := false
+	for _, name := range avds {
+		found = found || name == avd
+	}
+	if !found {
+		return "", fmt.Errorf("AVD %s not found, available: %s", avd, strings.Join(avds, ", "))
+	}
+
+	emus, err := runningEmulators(androidHome)
+	if err != nil {
+		return "", err
+	}
+	used := map[int]bool{}
+	for _, e := range emus {
+		if e.avd == avd {
+			return e.serial, nil
+		}
+		used[e.port] = true
+	}
+	port := 0
+	for p := firstConsolePort; p <= lastConsolePort; p += 2 {
+		if !used[p] {
+			port = p
+			break
+		}
+	}
+	if port == 0 {
+		return "", errors.New("no free emulator port")
+	}
+
+	emulator, err := findEmulator(androidHome)
+	if err != nil {
+		return "", err
+	}
+	logDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	logDir = filepath.Join(logDir, "gni")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return "", err
+	}
+	logFile := filepath.Join(logDir, "emulator-"+avd+".log")
+	log, err := os.Create(logFile)
+	if err != nil {
+		return "", err
+	}
+	defer log.Close()
+
+	cmd := exec.Command(emulator, "-avd", avd, "-port", strconv.Itoa(port))
+	if noWindow {
+		cmd.Args = append(cmd.Args, "-no-window")
+	}
+	cmd.Stdout = log
+	cmd.Stderr = log
+	detach(cmd)
+	fmt.Printf("Starting emulator %s...\n", avd)
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	serial := fmt.Sprintf("emulator-%d", port)
+	if err := waitBoot(androidHome, serial, timeout, exited); err != nil {
+		return "", fmt.Errorf("%w, see %s", err, logFile)
+	}
+	fmt.Printf("Emulator %s booted as %s\n", avd, serial)
+	return serial, nil
+}
+
+// waitBoot waits for the device to report sys.boot_completed.
+func waitBoot(androidHome, serial string, timeout time.Duration, exited <-chan error) error {
+	deadline := time.After(timeout)
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		select {
+		case err := <-exited:
+			if err == nil {
+				err = errors.New("exited")
+			}
+			return fmt.Errorf("emulator %s failed to start: %v", serial, err)
+		case <-deadline:
+			return fmt.Errorf("emulator %s didn't boot in %s", serial, timeout)
+		case <-tick.C:
+		}
+
+		devices, err := listDevices(androidHome)
+		if err != nil {
+			return err
+		}
+		if _, err := findDevice(devices, serial); err != nil {
+			continue
+		}
+		adb, err := NewADB(androidHome, serial)
+		if err != nil {
+			return err
+		}
+		if booted, err := adb.GetProp("sys.boot_completed"); err == nil && booted == "1" {
+			return nil
+		}
+	}
+}
+
+// stopEmulators stops the emulators given by AVD name or serial. Without
+// any, the only running emulator is stopped.
+func stopEmulators(androidHome string, names []string, all bool) error {
+	emus, err := runningEmulators(androidHome)
+	if err != nil {
+		return err
+	}
+	if len(emus) == 0 {
+		return errors.New("no running emulators")
+	}
+
+	var stop []runningEmulator
+	switch {
+	case all:
+		stop = emus
+	case len(names) == 0:
+		if len(emus) > 1 {
+			return errors.New("multiple emulators running, specify one or use -all")
+		}
+		stop = emus
+	default:
+		for _, name := range names {
+			found := false
+			for _, e := range emus {
+				if e.avd == name || e.serial == name {
+					stop = append(stop, e)
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("emulator %s is not running", name)
+			}
+		}
+	}
+
+	for _, e := range stop {
+		fmt.Printf("Stopping emulator %s (%s)...\n", e.avd, e.serial)
+		c, err := dialConsole(e.port)
+		if err != nil {
+			return err
+		}
+		_, err = c.command("kill")
+		c.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// console is a connection to the telnet console of an emulator.
+type console struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// dialConsole connects to the console of the emulator and authenticates
+// with the token of the user, if any.
+func dialConsole(port int) (*console, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("localhost", strconv.Itoa(port)), 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	c := &console{Conn: conn, r: bufio.NewReader(conn)}
+	if _, err := c.reply(); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return c, nil
+	}
+	token, err := os.ReadFile(filepath.Join(home, ".emulator_console_auth_token"))
+	if err != nil {
+		return c, nil
+	}
+	if _, err := c.command("auth " + strings.TrimSpace(string(token))); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// command runs a console command and returns its output.
+func (c *console) command(cmd string) (string, error) {
+	if _, err := fmt.Fprintf(c, "%s\r\n", cmd); err != nil {
+		return "", err
+	}
+	out, err := c.reply()
+	if err != nil {
+		return "", fmt.Errorf("emulator console: %s: %w", cmd, err)
+	}
+	return out, nil
+}
+
+// reply reads the lines up to the OK or KO status line.
+func (c *console) reply() (string, error) {
+	c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var lines []string
+	for {
+		l, err := c.r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		l = strings.TrimRight(l, "\r\n")
+		switch {
+		case strings.HasPrefix(l, "OK"):
+			return strings.Join(lines, "\n"), nil
+		case strings.HasPrefix(l, "KO"):
+			return "", errors.New(strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(l, "KO"), ":")))
+		}
+		lines = append(lines, l)
+	}
+}
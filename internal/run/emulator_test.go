@@ -0,0 +1,47 @@
+package run
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAVDs(t *testing.T) {
+	out := "INFO    | Storing crashdata in: /tmp/android/emu-crash.db\nPixel_6_API_34\n\nsmall_phone\n"
+	assert.Equal(t, []string{"Pixel_6_API_34", "small_phone"}, parseAVDs(out))
+}
+
+func TestConsole(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		r := bufio.NewReader(server)
+		server.Write([]byte("Android Console: Authentication required\r\nOK\r\n"))
+		for {
+			l, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch strings.TrimSpace(l) {
+			case "avd name":
+				server.Write([]byte("Pixel_6_API_34\r\nOK\r\n"))
+			default:
+				server.Write([]byte("KO: unknown command, try 'help'\r\n"))
+			}
+		}
+	}()
+
+	c := &console{Conn: client, r: bufio.NewReader(client)}
+	_, err := c.reply()
+	require.NoError(t, err)
+	name, err := c.command("avd name")
+	require.NoError(t, err)
+	assert.Equal(t, "Pixel_6_API_34", name)
+	_, err = c.command("bogus")
+	assert.ErrorContains(t, err, "unknown command")
+}
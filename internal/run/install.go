@@ -0,0 +1,185 @@
+package run
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gni.dev/cmd/internal/build"
+)
+
+// overrideLib is where a debuggable app loads libgni.so from, relative to
+// its data dir, in place of the library of the APK. Only the gni backends
+// from build.BackendLibOverride on support it, see checkBackend.
+const overrideLib = "code_cache/libgni.so"
+
+// installState records what was last deployed to a device.
+type installState struct {
+	// APK is the hash of the APK installed on the device.
+	APK string `json:"apk"`
+	// Deployed is the hash of the last deployed APK, which differs from APK
+	// when only the library was pushed.
+	Deployed string `json:"deployed"`
+	// Content is the digest of the deployed APK without native libraries.
+	Content string `json:"content"`
+}
+
+// installStateFile returns the file recording what was deployed on the
+// device. It lives out of the build dir, which is wiped by each build.
+func installStateFile(a *build.Args, appID, serial string) string {
+	name := strings.NewReplacer(":", "_", "/", "_").Replace(serial) + ".json"
+	return filepath.Join(a.OutDir(), "installed", appID, name)
+}
+
+func readInstallState(file string) installState {
+	var st installState
+	if data, err := os.ReadFile(file); err == nil {
+		json.Unmarshal(data, &st)
+	}
+	return st
+}
+
+func writeInstallState(file string, st installState) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+func fileHash(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// apkContentDigest returns a digest of the entries of the APK, leaving out
+// the native libraries and the signature.
+func apkContentDigest(apk string) (string, error) {
+	r, err := zip.OpenReader(apk)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	var entries []string
+	for _, f := range r.File {
+		if strings.HasPrefix(f.Name, "lib/") || strings.HasPrefix(f.Name, "META-INF/") {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("%s %08x %d", f.Name, f.CRC32, f.UncompressedSize64))
+	}
+	sort.Strings(entries)
+	h := sha256.Sum256([]byte(strings.Join(entries, "\n")))
+	return hex.EncodeToString(h[:]), nil
+}
+
+// installedAPKHash returns the hash of the APK of the installed app, or ""
+// if it is not installed or split into several APKs.
+func installedAPKHash(adb *ADB, appID string) string {
+	out, err := adb.Shell("pm", "path", appID)
+	if err != nil {
+		return ""
+	}
+	var paths []string
+	for _, l := range strings.Split(out, "\n") {
+		if p := strings.TrimSpace(l); strings.HasPrefix(p, "package:") {
+			paths = append(paths, strings.TrimPrefix(p, "package:"))
+		}
+	}
+	if len(paths) != 1 {
+		return ""
+	}
+	out, err = adb.Shell("sha256sum", paths[0])
+	if err != nil {
+		return ""
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// pushLib replaces the library loaded by the debuggable app.
+func pushLib(adb *ADB, appID, lib string) error {
+	tmp := "/data/local/tmp/" + appID + "-libgni.so"
+	if err := adb.Push(lib, tmp); err != nil {
+		return err
+	}
+	defer adb.Shell("rm", "-f", tmp)
+	if _, err := adb.RunAs(appID, "mkdir", "-p", path.Dir(overrideLib)); err != nil {
+		return err
+	}
+	_, err := adb.RunAs(appID, "cp", tmp, overrideLib)
+	return err
+}
+
+// installIfChanged installs apk unless the device has it already. When only
+// libgni.so changed in a debuggable build whose backend loads overrideLib,
+// just the library is pushed. It reports whether anything was deployed.
+func installIfChanged(out io.Writer, adb *ADB, m build.Metadata, a *Args, apk string, d Device) (bool, error) {
+	apkHash, err := fileHash(apk)
+	if err != nil {
+		return false, err
+	}
+	content, err := apkContentDigest(apk)
+	if err != nil {
+		return false, err
+	}
+	stateFile := installStateFile(a.buildArgs, m.AppID, d.Serial)
+	st := readInstallState(stateFile)
+
+	if !a.clean {
+		installed := installedAPKHash(adb, m.AppID)
+		switch {
+		case installed == "":
+		case installed == apkHash:
+			if st.Deployed == "" || st.Deployed == apkHash {
+				fmt.Fprintf(out, "%s is up to date\n", m.AppID)
+				return false, nil
+			}
+			// back to the installed library
+			if _, err := adb.RunAs(m.AppID, "rm", "-f", overrideLib); err == nil {
+				return true, writeInstallState(stateFile, installState{APK: apkHash, Deployed: apkHash, Content: content})
+			}
+		case installed == st.APK && st.Deployed == apkHash:
+			fmt.Fprintf(out, "%s is up to date\n", m.AppID)
+			return false, nil
+		case installed == st.APK && content == st.Content && a.libOverride:
+			if lib, ok := build.NativeLibs(a.buildArgs)[d.ABI]; ok {
+				fmt.Fprintf(out, "Only %s changed, pushing it...\n", filepath.Base(lib))
+				if err := pushLib(adb, m.AppID, lib); err == nil {
+					st.Deployed = apkHash
+					return true, writeInstallState(stateFile, st)
+				}
+			}
+		}
+	}
+
+	fmt.Fprintf(out, "Installing %s...\n", filepath.Base(apk))
+	if err := installAPK(out, adb, m.AppID, apk, a.clean); err != nil {
+		return false, err
+	}
+	if a.buildArgs.DebugBuild() {
+		adb.RunAs(m.AppID, "rm", "-f", overrideLib)
+	}
+	return true, writeInstallState(stateFile, installState{APK: apkHash, Deployed: apkHash, Content: content})
+}
@@ -0,0 +1,153 @@
+package run
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gni.dev/cmd/internal/build"
+)
+
+func writeZip(t *testing.T, name string, files map[string]string) string {
+	p := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(p)
+	require.NoError(t, err)
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		fw.Write([]byte(content))
+	}
+	require.NoError(t, w.Close())
+	return p
+}
+
+func TestAPKContentDigest(t *testing.T) {
+	base := map[string]string{
+		"AndroidManifest.xml":        "manifest",
+		"classes.dex":                "dex",
+		"lib/x86_64/libgni.so":       "lib v1",
+		"META-INF/ANDROIDD.SF":       "sig v1",
+		"res/mipmap/ic_launcher.png": "icon",
+	}
+	digest := func(changes map[string]string) string {
+		files := map[string]string{}
+		for k, v := range base {
+			files[k] = v
+		}
+		for k, v := range changes {
+			files[k] = v
+		}
+		d, err := apkContentDigest(writeZip(t, "app.apk", files))
+		require.NoError(t, err)
+		return d
+	}
+
+	want := digest(nil)
+	assert.Equal(t, want, digest(map[string]string{"lib/x86_64/libgni.so": "lib v2", "META-INF/ANDROIDD.SF": "sig v2"}))
+	assert.NotEqual(t, want, digest(map[string]string{"classes.dex": "dex v2"}))
+	assert.NotEqual(t, want, digest(map[string]string{"assets/data.txt": "new"}))
+}
+
+// fakeDevice answers the package manager commands of installIfChanged for
+// a device of s.
+type fakeDevice struct {
+	s         *fakeADB
+	installed []byte
+	commands  []string
+}
+
+func (d *fakeDevice) shell(cmd string) (string, int) {
+	d.commands = append(d.commands, cmd)
+	switch {
+	case strings.HasPrefix(cmd, "pm path "):
+		if d.installed == nil {
+			return "", 1
+		}
+		return "package:/data/app/base.apk\n", 0
+	case cmd == "sha256sum /data/app/base.apk":
+		h := sha256.Sum256(d.installed)
+		return hex.EncodeToString(h[:]) + "  /data/app/base.apk\n", 0
+	case strings.HasPrefix(cmd, "pm install "):
+		f := strings.Fields(cmd)
+		d.installed = d.s.files[f[len(f)-1]]
+		return "Success\n", 0
+	case strings.Contains(cmd, "pidof"):
+		return "", 1
+	default:
+		return "", 0
+	}
+}
+
+// fakeBuild does what BuildAndroid does to the output dir: it wipes the
+// build dir and writes the library and the APK holding it.
+func fakeBuild(t *testing.T, a *build.Args, m build.Metadata, lib string) string {
+	require.NoError(t, os.RemoveAll(a.BuildDir()))
+	libFile := filepath.Join(a.BuildDir(), "lib", "x86_64", "libgni.so")
+	require.NoError(t, os.MkdirAll(filepath.Dir(libFile), 0o755))
+	require.NoError(t, os.WriteFile(libFile, []byte(lib), 0o644))
+
+	apk := a.APK(m)
+	f, err := os.Create(apk)
+	require.NoError(t, err)
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for _, e := range [][2]string{
+		{"AndroidManifest.xml", "manifest"},
+		{"classes.dex", "dex"},
+		{"lib/x86_64/libgni.so", lib},
+	} {
+		fw, err := w.Create(e[0])
+		require.NoError(t, err)
+		fw.Write([]byte(e[1]))
+	}
+	require.NoError(t, w.Close())
+	return apk
+}
+
+func TestDeploySkipsUnchanged(t *testing.T) {
+	s := newFakeADB(t)
+	dev := &fakeDevice{s: s}
+	s.shell = dev.shell
+	adb := &ADB{addr: s.l.Addr().String(), serial: "emulator-5554"}
+	d := Device{Serial: "emulator-5554", ABI: "x86_64"}
+	m := build.Metadata{AppID: "dev.gni.app", Name: "app", Package: "example.com/app"}
+
+	f := flag.NewFlagSet("run", flag.ContinueOnError)
+	a := CreateArgs(f)
+	require.NoError(t, f.Parse([]string{"-o", t.TempDir(), "-debug"}))
+
+	deployOut := func() string {
+		var out bytes.Buffer
+		require.NoError(t, deploy(&out, adb, m, a, a.buildArgs.APK(m), d))
+		return out.String()
+	}
+
+	fakeBuild(t, a.buildArgs, m, "lib v1")
+	assert.Contains(t, deployOut(), "Installing app.apk")
+
+	fakeBuild(t, a.buildArgs, m, "lib v1")
+	assert.Contains(t, deployOut(), "dev.gni.app is up to date")
+
+	// only the library changed, but the backend doesn't load overrideLib
+	fakeBuild(t, a.buildArgs, m, "lib v2")
+	assert.Contains(t, deployOut(), "Installing app.apk")
+
+	a.libOverride = true
+	fakeBuild(t, a.buildArgs, m, "lib v3")
+	assert.Contains(t, deployOut(), "Only libgni.so changed")
+	assert.Equal(t, []byte("lib v3"), s.files["/data/local/tmp/dev.gni.app-libgni.so"])
+	assert.Contains(t, dev.commands, "run-as dev.gni.app cp /data/local/tmp/dev.gni.app-libgni.so "+overrideLib)
+
+	fakeBuild(t, a.buildArgs, m, "lib v3")
+	assert.Contains(t, deployOut(), "dev.gni.app is up to date")
+}
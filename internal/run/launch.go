@@ -0,0 +1,115 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gni.dev/cmd/internal/build"
+)
+
+// Intent extras read by the activity of the gni backend at launch, from
+// BackendIndexedExtras on. The program arguments are passed one String
+// extra per argument, extraArg followed by the index, after the Integer
+// extra extraArgCount; the backend exposes them as os.Args[1:]. The
+// environment is passed the same way with extraEnv and extraEnvCount, as
+// KEY=VALUE entries set with os.Setenv before main runs. Values are passed
+// as is, with no escaping. The -es and -ei extras and the -data URI are
+// passed as is too, for the app to read from the launch intent.
+const (
+	extraArgCount = "dev.gni.argc"
+	extraArg      = "dev.gni.arg."
+	extraEnvCount = "dev.gni.envc"
+	extraEnv      = "dev.gni.env."
+)
+
+// checkBackend looks at what the gni backend of the built app supports,
+// from its version: loading overrideLib, and reading the launch extras of
+// a, which older backends ignore.
+func (a *Args) checkBackend(out io.Writer) {
+	dir, _, err := build.BackendSources(a.buildArgs)
+	if err != nil {
+		return
+	}
+	v, err := build.BackendVersion(dir)
+	if err != nil {
+		fmt.Fprintln(out, "Warning:", err)
+		return
+	}
+	a.libOverride = a.buildArgs.DebugBuild() && v >= build.BackendLibOverride
+	if (len(a.appArgs) > 0 || len(a.env) > 0) && v < build.BackendIndexedExtras {
+		fmt.Fprintln(out, "Warning: the gni backend doesn't read the program arguments and environment variables, update gni.dev/gni")
+	}
+}
+
+// launchArgs returns the am start arguments launching the app with the
+// arguments, extras and data of a. With wait, am waits for the launch to
+// complete.
+func (a *Args) launchArgs(m build.Metadata, wait bool) ([]string, error) {
+	args := []string{"am", "start"}
+	if wait {
+		args = append(args, "-W")
+	}
+	args = append(args, "-n", fmt.Sprintf("%s/%s", m.AppID, mainActivity))
+	if a.data != "" {
+		args = append(args, "-a", "android.intent.action.VIEW", "-d", a.data)
+	}
+	for _, kv := range a.env {
+		if !strings.Contains(kv, "=") {
+			return nil, fmt.Errorf("invalid environment variable %q, want KEY=VALUE", kv)
+		}
+	}
+	args = appendIndexedExtras(args, extraArgCount, extraArg, a.appArgs)
+	args = appendIndexedExtras(args, extraEnvCount, extraEnv, a.env)
+	for _, kv := range a.stringExtras {
+		k, v, ok := splitExtra(kv)
+		if !ok {
+			return nil, fmt.Errorf("invalid extra %q, want KEY=VALUE", kv)
+		}
+		args = append(args, "--es", k, v)
+	}
+	for _, kv := range a.intExtras {
+		k, v, ok := splitExtra(kv)
+		if !ok {
+			return nil, fmt.Errorf("invalid extra %q, want KEY=VALUE", kv)
+		}
+		if _, err := strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid integer extra %q", kv)
+		}
+		args = append(args, "--ei", k, v)
+	}
+	return args, nil
+}
+
+func splitExtra(kv string) (string, string, bool) {
+	i := strings.Index(kv, "=")
+	if i <= 0 {
+		return "", "", false
+	}
+	return kv[:i], kv[i+1:], true
+}
+
+// appendIndexedExtras appends to args the am extras passing values, none
+// if there are no values.
+func appendIndexedExtras(args []string, countKey, prefix string, values []string) []string {
+	if len(values) == 0 {
+		return args
+	}
+	args = append(args, "--ei", countKey, strconv.Itoa(len(values)))
+	for i, v := range values {
+		args = append(args, "--es", prefix+strconv.Itoa(i), v)
+	}
+	return args
+}
+
+// splitAppArgs splits the command line at the first --, the arguments after
+// it are passed to the app.
+func splitAppArgs(args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,63 @@
+package run
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gni.dev/cmd/internal/build"
+)
+
+func TestLaunchArgs(t *testing.T) {
+	m := build.Metadata{AppID: "dev.gni.app"}
+	tests := []struct {
+		args Args
+		wait bool
+		want []string
+		err  string
+	}{
+		{
+			want: []string{"am", "start", "-n", "dev.gni.app/dev.gni.GniActivity"},
+		},
+		{
+			args: Args{
+				appArgs:      []string{"-flag", "a,b", ""},
+				env:          stringList{"GODEBUG=gctrace=1"},
+				stringExtras: stringList{"user=gopher=1"},
+				intExtras:    stringList{"level=3"},
+				data:         "myapp://item/42",
+			},
+			wait: true,
+			want: []string{
+				"am", "start", "-W", "-n", "dev.gni.app/dev.gni.GniActivity",
+				"-a", "android.intent.action.VIEW", "-d", "myapp://item/42",
+				"--ei", "dev.gni.argc", "3",
+				"--es", "dev.gni.arg.0", "-flag",
+				"--es", "dev.gni.arg.1", "a,b",
+				"--es", "dev.gni.arg.2", "",
+				"--ei", "dev.gni.envc", "1",
+				"--es", "dev.gni.env.0", "GODEBUG=gctrace=1",
+				"--es", "user", "gopher=1",
+				"--ei", "level", "3",
+			},
+		},
+		{args: Args{intExtras: stringList{"level=high"}}, err: "invalid integer extra"},
+		{args: Args{stringExtras: stringList{"=x"}}, err: "invalid extra"},
+		{args: Args{env: stringList{"HOME"}}, err: "invalid environment variable"},
+	}
+	for _, test := range tests {
+		got, err := test.args.launchArgs(m, test.wait)
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, test.want, got)
+	}
+}
+
+func TestSplitAppArgs(t *testing.T) {
+	args, appArgs := splitAppArgs([]string{"-debug", "./cmd/app", "--", "-v", "--", "x"})
+	assert.Equal(t, []string{"-debug", "./cmd/app"}, args)
+	assert.Equal(t, []string{"-v", "--", "x"}, appArgs)
+}
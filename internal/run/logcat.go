@@ -0,0 +1,217 @@
+package run
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pidPollInterval is how often the PIDs of the app are looked up, in case
+// the ActivityManager lines announcing a new process are missed.
+const pidPollInterval = 2 * time.Second
+
+var (
+	// logLineRe matches a line of logcat -v threadtime:
+	// 10-19 12:00:00.123  1234  1250 I GoLog   : message
+	logLineRe = regexp.MustCompile(`^(\d\d-\d\d \d\d:\d\d:\d\d\.\d+)\s+(\d+)\s+(\d+)\s+([VDIWEFS])\s+(.*?)\s*: ?(.*)$`)
+	// procStartRe matches the ActivityManager line of a process start.
+	procStartRe = regexp.MustCompile(`^Start proc (\d+):([^/\s]+)/`)
+	// procDiedRe matches the ActivityManager line of a process death.
+	procDiedRe = regexp.MustCompile(`^Process (\S+) \(pid (\d+)\) has died`)
+)
+
+// ANSI colors of the log priorities.
+var prioColors = map[byte]string{
+	'V': "\033[90m",
+	'D': "\033[34m",
+	'I': "\033[32m",
+	'W': "\033[33m",
+	'E': "\033[31m",
+	'F': "\033[1;31m",
+}
+
+const (
+	colorPanic = "\033[1;31m"
+	colorReset = "\033[0m"
+)
+
+type logEntry struct {
+	time string
+	pid  int
+	tid  int
+	prio byte
+	tag  string
+	msg  string
+}
+
+func parseLogLine(l string) (logEntry, bool) {
+	s := logLineRe.FindStringSubmatch(l)
+	if s == nil {
+		return logEntry{}, false
+	}
+	pid, _ := strconv.Atoi(s[2])
+	tid, _ := strconv.Atoi(s[3])
+	return logEntry{time: s[1], pid: pid, tid: tid, prio: s[4][0], tag: s[5], msg: s[6]}, true
+}
+
+// logcat prints the log lines of the processes of an app.
+type logcat struct {
+	w     io.Writer
+	appID string
+	color bool
+
+	mu   sync.Mutex
+	pids map[int]bool
+	// panicPID and panicTag identify the open block of a Go panic, panicPID
+	// is 0 when there is none.
+	panicPID int
+	panicTag string
+}
+
+func newLogcat(w io.Writer, appID string, color bool) *logcat {
+	return &logcat{w: w, appID: appID, color: color, pids: map[int]bool{}}
+}
+
+// addPID starts following a process of the app.
+func (lc *logcat) addPID(pid int) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.pids[pid] = true
+}
+
+func (lc *logcat) line(l string) {
+	e, ok := parseLogLine(l)
+	if !ok {
+		return
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	if e.tag == "ActivityManager" {
+		if s := procStartRe.FindStringSubmatch(e.msg); s != nil && s[2] == lc.appID {
+			pid, _ := strconv.Atoi(s[1])
+			lc.endPanic()
+			lc.pids[pid] = true
+			lc.marker(fmt.Sprintf("--- process %d started", pid))
+			return
+		}
+		if s := procDiedRe.FindStringSubmatch(e.msg); s != nil && s[1] == lc.appID {
+			pid, _ := strconv.Atoi(s[2])
+			lc.endPanic()
+			delete(lc.pids, pid)
+			lc.marker(fmt.Sprintf("--- process %d died", pid))
+			return
+		}
+	}
+	if !lc.pids[e.pid] {
+		return
+	}
+
+	if lc.panicPID != 0 {
+		if e.pid == lc.panicPID && e.tag == lc.panicTag {
+			lc.print(colorPanic, e.msg)
+			return
+		}
+		lc.endPanic()
+	}
+	if strings.HasPrefix(e.msg, "panic: ") || strings.HasPrefix(e.msg, "fatal error: ") {
+		lc.panicPID, lc.panicTag = e.pid, e.tag
+		lc.print(colorPanic, fmt.Sprintf("=== Go %s in process %d ===", strings.SplitN(e.msg, ":", 2)[0], e.pid))
+		lc.print(colorPanic, e.msg)
+		return
+	}
+	lc.print(prioColors[e.prio], fmt.Sprintf("%s %c %s: %s", e.time, e.prio, e.tag, e.msg))
+}
+
+// endPanic closes the open block of a Go panic, if any.
+func (lc *logcat) endPanic() {
+	if lc.panicPID == 0 {
+		return
+	}
+	lc.print(colorPanic, "=== end of panic ===")
+	lc.panicPID, lc.panicTag = 0, ""
+}
+
+func (lc *logcat) marker(msg string) {
+	lc.print("\033[1m", msg)
+}
+
+func (lc *logcat) print(color, s string) {
+	if lc.color && color != "" {
+		s = color + s + colorReset
+	}
+	fmt.Fprintln(lc.w, s)
+}
+
+// deviceTime returns the current time of the device in the format of the
+// logcat -T option.
+func deviceTime(adb *ADB) (string, error) {
+	return adb.Shell("date", "+%m-%d %H:%M:%S.000")
+}
+
+// streamLogcat prints the logs of appID since the device time since until
+// ctx is canceled. The processes of the app are followed across restarts.
+func streamLogcat(ctx context.Context, adb *ADB, lc *logcat, since string) error {
+	pidof := func() {
+		out, err := adb.Shell("pidof", lc.appID)
+		if err != nil {
+			return
+		}
+		for _, f := range strings.Fields(out) {
+			if pid, err := strconv.Atoi(f); err == nil {
+				lc.addPID(pid)
+			}
+		}
+	}
+	pidof()
+	go func() {
+		t := time.NewTicker(pidPollInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				pidof()
+			}
+		}
+	}()
+
+	args := []string{"logcat", "-v", "threadtime", "-T", "1"}
+	if since != "" {
+		args[len(args)-1] = since
+	}
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		code, err := adb.shell(ctx, nil, pw, io.Discard, args...)
+		if err == nil && code != 0 {
+			err = fmt.Errorf("logcat exited with status %d", code)
+		}
+		pw.Close()
+		errc <- err
+	}()
+	s := bufio.NewScanner(pr)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		lc.line(strings.TrimSuffix(s.Text(), "\r"))
+	}
+	// drain the pipe if the scanner stopped on a too long line
+	io.Copy(io.Discard, pr)
+
+	lc.mu.Lock()
+	lc.endPanic()
+	lc.mu.Unlock()
+
+	err := <-errc
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+package run
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogcat(t *testing.T) {
+	input := []string{
+		"--------- beginning of main",
+		"10-19 12:00:00.100   600   620 I ActivityManager: Start proc 1234:dev.gni.app/u0a123 for top-activity {dev.gni.app/dev.gni.GniActivity}",
+		"10-19 12:00:00.200  1234  1234 I GoLog   : hello",
+		"10-19 12:00:00.250   999   999 W Other   : not ours",
+		"10-19 12:00:00.300  1234  1250 E GoLog   : panic: boom",
+		"10-19 12:00:00.300  1234  1250 E GoLog   : ",
+		"10-19 12:00:00.300  1234  1250 E GoLog   : goroutine 1 [running]:",
+		"10-19 12:00:00.400  1234  1234 F libc    : Fatal signal 6 (SIGABRT)",
+		"10-19 12:00:00.500   600   620 I ActivityManager: Process dev.gni.app (pid 1234) has died: fg TOP",
+		"10-19 12:00:00.600  1234  1234 I GoLog   : stale",
+	}
+	want := `--- process 1234 started
+10-19 12:00:00.200 I GoLog: hello
+=== Go panic in process 1234 ===
+panic: boom
+
+goroutine 1 [running]:
+=== end of panic ===
+10-19 12:00:00.400 F libc: Fatal signal 6 (SIGABRT)
+--- process 1234 died
+`
+	var out bytes.Buffer
+	lc := newLogcat(&out, "dev.gni.app", false)
+	for _, l := range input {
+		lc.line(l)
+	}
+	assert.Equal(t, want, out.String())
+}
@@ -0,0 +1,156 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"gni.dev/cmd/internal/build"
+)
+
+// prefixWriter writes whole lines to w, prefixed by prefix. The lines of
+// writers sharing mu are not interleaved.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		p.mu.Lock()
+		_, err := fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf[:i])
+		p.mu.Unlock()
+		p.buf = p.buf[i+1:]
+		if err != nil {
+			return len(b), err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush writes the last line if it isn't terminated.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.Write([]byte{'\n'})
+	}
+}
+
+// runDevices installs and launches apk on devices in parallel, then
+// streams their logs unless detached.
+func runDevices(androidHome string, m build.Metadata, a *Args, apk string, devices []Device, rules []portRule) error {
+	width := 0
+	for _, d := range devices {
+		if len(d.Serial) > width {
+			width = len(d.Serial)
+		}
+	}
+	var mu sync.Mutex
+	outs := make([]*prefixWriter, len(devices))
+	for i, d := range devices {
+		outs[i] = &prefixWriter{w: os.Stdout, mu: &mu, prefix: fmt.Sprintf("%-*s | ", width, d.Serial)}
+	}
+
+	adbs := make([]*ADB, len(devices))
+	sinces := make([]string, len(devices))
+	removePorts := make([]func(), len(devices))
+	errs := make([]error, len(devices))
+	var wg sync.WaitGroup
+	for i, d := range devices {
+		wg.Add(1)
+		go func(i int, d Device) {
+			defer wg.Done()
+			out := outs[i]
+			defer out.Flush()
+			adb, err := NewADB(androidHome, d.Serial)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if err := deploy(out, adb, m, a, apk, d); err != nil {
+				errs[i] = err
+				return
+			}
+			if removePorts[i], err = setupPorts(out, adb, rules); err != nil {
+				errs[i] = err
+				return
+			}
+			sinces[i], _ = deviceTime(adb)
+			launch, err := a.launchArgs(m, false)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			fmt.Fprintf(out, "Launching %s...\n", m.AppID)
+			if _, err := adb.Shell(launch...); err != nil {
+				errs[i] = err
+				return
+			}
+			adbs[i] = adb
+		}(i, d)
+	}
+	wg.Wait()
+	// the mappings outlive a detached session on purpose, so that the app
+	// keeps reaching the workstation
+	if !a.detach {
+		defer func() {
+			for _, remove := range removePorts {
+				if remove != nil {
+					remove()
+				}
+			}
+		}()
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERIAL\tMODEL\tABI\tSTATUS")
+	for i, d := range devices {
+		status := "ok"
+		if errs[i] != nil {
+			failed++
+			status = "FAILED: " + strings.SplitN(strings.TrimSpace(errs[i].Error()), "\n", 2)[0]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Serial, d.Model, d.ABI, status)
+	}
+	w.Flush()
+
+	var err error
+	if failed > 0 {
+		err = fmt.Errorf("failed on %d of %d devices", failed, len(devices))
+	}
+	if a.detach || failed == len(devices) {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	for i, adb := range adbs {
+		if adb == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(out *prefixWriter, adb *ADB, since string) {
+			defer wg.Done()
+			defer out.Flush()
+			lc := newLogcat(out, m.AppID, isTerminal(os.Stdout))
+			if err := streamLogcat(ctx, adb, lc, since); err != nil {
+				fmt.Fprintln(out, err)
+			}
+		}(outs[i], adb, sinces[i])
+	}
+	wg.Wait()
+	return err
+}
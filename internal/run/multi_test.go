@@ -0,0 +1,57 @@
+package run
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gni.dev/cmd/internal/build"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	var mu sync.Mutex
+	w := &prefixWriter{w: &out, mu: &mu, prefix: "emulator-5554 | "}
+	w.Write([]byte("Installing app.apk...\nLaun"))
+	w.Write([]byte("ching\npartial"))
+	w.Flush()
+	assert.Equal(t, "emulator-5554 | Installing app.apk...\nemulator-5554 | Launching\nemulator-5554 | partial\n", out.String())
+}
+
+func TestRunDevicesRemovesPorts(t *testing.T) {
+	for _, detach := range []bool{false, true} {
+		s := newFakeADB(t)
+		dev := &fakeDevice{s: s}
+		s.shell = func(cmd string) (string, int) {
+			if strings.HasPrefix(cmd, "am start") {
+				return "Error: Activity not started\n", 1
+			}
+			return dev.shell(cmd)
+		}
+		t.Setenv("ADB_SERVER_SOCKET", "tcp:"+s.l.Addr().String())
+
+		f := flag.NewFlagSet("run", flag.ContinueOnError)
+		a := CreateArgs(f)
+		require.NoError(t, f.Parse([]string{"-o", t.TempDir(), "-forward", "9222"}))
+		a.detach = detach
+		rules, err := a.portRules()
+		require.NoError(t, err)
+
+		m := build.Metadata{AppID: "dev.gni.app", Name: "app", Package: "example.com/app"}
+		apk := fakeBuild(t, a.buildArgs, m, "lib")
+		devices := []Device{{Serial: "emulator-5554", ABI: "x86_64"}}
+		err = runDevices("", m, a, apk, devices, rules)
+		assert.ErrorContains(t, err, "failed on 1 of 1 devices")
+
+		assert.Equal(t, []string{"tcp:9222;tcp:9222"}, s.forwards)
+		if detach {
+			assert.Empty(t, s.removed)
+		} else {
+			assert.Equal(t, []string{"tcp:9222"}, s.removed)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gni.dev/cmd/internal/build"
+)
+
+// portRule is an adb reverse or forward mapping.
+type portRule struct {
+	reverse bool
+	// from and to are in the order of the adb command: the device socket
+	// first for reverse, the workstation socket first for forward.
+	from string
+	to   string
+}
+
+func (r portRule) String() string {
+	kind := "forward"
+	if r.reverse {
+		kind = "reverse"
+	}
+	return fmt.Sprintf("%s %s %s", kind, r.from, r.to)
+}
+
+// parsePortRule parses a port number or a pair of adb socket specs.
+func parsePortRule(s string, reverse bool) (portRule, error) {
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+		fields = append(fields, fields[0])
+	case 2:
+	default:
+		return portRule{}, fmt.Errorf("invalid port mapping %q", s)
+	}
+	for i, f := range fields {
+		if n, err := strconv.Atoi(f); err == nil {
+			if n <= 0 || n > 65535 {
+				return portRule{}, fmt.Errorf("invalid port %d in %q", n, s)
+			}
+			fields[i] = "tcp:" + f
+		} else if !strings.Contains(f, ":") {
+			return portRule{}, fmt.Errorf("invalid socket %q in %q", f, s)
+		}
+	}
+	return portRule{reverse: reverse, from: fields[0], to: fields[1]}, nil
+}
+
+// stringList is a flag which can be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// portRules returns the port mappings of the project config and of the
+// flags. A flag replaces the mapping of the same socket in the config.
+func (a *Args) portRules() ([]portRule, error) {
+	var ports build.Ports
+	if p := a.buildArgs.Config().Ports; p != nil {
+		ports = *p
+	}
+	var rules []portRule
+	add := func(specs []string, reverse bool) error {
+		for _, s := range specs {
+			r, err := parsePortRule(s, reverse)
+			if err != nil {
+				return err
+			}
+			replaced := false
+			for i := range rules {
+				if rules[i].reverse == r.reverse && rules[i].from == r.from {
+					rules[i] = r
+					replaced = true
+				}
+			}
+			if !replaced {
+				rules = append(rules, r)
+			}
+		}
+		return nil
+	}
+	for _, p := range []struct {
+		specs   []string
+		reverse bool
+	}{
+		{ports.Reverse, true},
+		{ports.Forward, false},
+		{a.reverse, true},
+		{a.forward, false},
+	} {
+		if err := add(p.specs, p.reverse); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// checkDeviceRules fails if rules can't be set up on each of n devices. A
+// forward binds a workstation port, which adb rebinds for the last device
+// and which the cleanup of any device removes for all of them.
+func checkDeviceRules(rules []portRule, n int) error {
+	if n < 2 {
+		return nil
+	}
+	for _, r := range rules {
+		if !r.reverse {
+			return fmt.Errorf("port %s can't be set up on %d devices, forward rules need a single device", r, n)
+		}
+	}
+	return nil
+}
+
+// setupPorts sets up the port mappings and returns the function removing
+// them.
+func setupPorts(out io.Writer, adb *ADB, rules []portRule) (func(), error) {
+	var done []portRule
+	remove := func() {
+		for _, r := range done {
+			if r.reverse {
+				adb.ReverseRemove(r.from)
+			} else {
+				adb.ForwardRemove(r.from)
+			}
+		}
+	}
+	for _, r := range rules {
+		var err error
+		if r.reverse {
+			err = adb.Reverse(r.from, r.to)
+		} else {
+			err = adb.Forward(r.from, r.to)
+		}
+		if err != nil {
+			remove()
+			return nil, fmt.Errorf("failed to set up %s: %w", r, err)
+		}
+		fmt.Fprintf(out, "Port %s\n", r)
+		done = append(done, r)
+	}
+	return remove, nil
+}
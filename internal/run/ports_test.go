@@ -0,0 +1,55 @@
+package run
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePortRule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		reverse bool
+		want    string
+		err     string
+	}{
+		{spec: "8080", reverse: true, want: "reverse tcp:8080 tcp:8080"},
+		{spec: "8080 9000", want: "forward tcp:8080 tcp:9000"},
+		{spec: "tcp:9222 localabstract:chrome_devtools_remote", want: "forward tcp:9222 localabstract:chrome_devtools_remote"},
+		{spec: "70000", err: "invalid port"},
+		{spec: "tcp:1 tcp:2 tcp:3", err: "invalid port mapping"},
+		{spec: "localhost tcp:1", err: "invalid socket"},
+	}
+	for _, test := range tests {
+		r, err := parsePortRule(test.spec, test.reverse)
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, test.spec)
+			continue
+		}
+		if assert.NoError(t, err, test.spec) {
+			assert.Equal(t, test.want, r.String())
+		}
+	}
+}
+
+func TestCheckDeviceRules(t *testing.T) {
+	reverse := portRule{reverse: true, from: "tcp:8080", to: "tcp:8080"}
+	forward := portRule{from: "tcp:9222", to: "tcp:9222"}
+	tests := []struct {
+		rules   []portRule
+		devices int
+		err     string
+	}{
+		{rules: []portRule{forward}, devices: 1},
+		{rules: []portRule{reverse}, devices: 3},
+		{rules: []portRule{reverse, forward}, devices: 2, err: "port forward tcp:9222 tcp:9222 can't be set up on 2 devices"},
+	}
+	for i, test := range tests {
+		err := checkDeviceRules(test.rules, test.devices)
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, "test #%d", i)
+		} else {
+			assert.NoError(t, err, "test #%d", i)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package run
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach keeps cmd running when gni is interrupted from the terminal.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
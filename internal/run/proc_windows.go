@@ -0,0 +1,11 @@
+package run
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach keeps cmd running when gni is interrupted from the terminal.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
@@ -17,7 +17,8 @@ func Run(args []string) {
 
 	runFlags := flag.NewFlagSet("run", flag.ExitOnError)
 	a := CreateArgs(runFlags)
-	if err := runFlags.Parse(args[1:]); err != nil {
+	args, a.appArgs = splitAppArgs(args[1:])
+	if err := runFlags.Parse(args); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -29,12 +30,12 @@ func Run(args []string) {
 		}
 	}
 
-	m, err := build.DefaultMetadata()
+	buildArgs, m, err := appMetadata(a.buildArgs, runFlags.Args())
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	m.FixupAndroidVer()
+	a.buildArgs = buildArgs
 
 	switch target {
 	case "android":
@@ -48,3 +49,24 @@ func Run(args []string) {
 		os.Exit(1)
 	}
 }
+
+// appMetadata returns the metadata of the only main package matching
+// patterns, with the build args of the package.
+func appMetadata(a *build.Args, patterns []string) (*build.Args, build.Metadata, error) {
+	if err := a.LoadConfig(); err != nil {
+		return nil, build.Metadata{}, err
+	}
+
+	a.SetPatterns(patterns)
+	pkgs, err := a.MainPackages()
+	if err != nil {
+		return nil, build.Metadata{}, err
+	}
+	if len(pkgs) != 1 {
+		return nil, build.Metadata{}, fmt.Errorf("only one main package can be run, %d matched", len(pkgs))
+	}
+	a = a.WithPackage(pkgs[0])
+
+	m, err := build.NewMetadata(a)
+	return a, m, err
+}
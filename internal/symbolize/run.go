@@ -0,0 +1,36 @@
+package symbolize
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func Run(args []string) {
+	var (
+		chdir  string
+		outDir string
+		lib    string
+	)
+	symFlags := flag.NewFlagSet("symbolize", flag.ExitOnError)
+	symFlags.StringVar(&chdir, "C", ".", "Change working directory before symbolizing")
+	symFlags.StringVar(&outDir, "o", "out", "Output path of the builds to look up symbols in")
+	symFlags.StringVar(&lib, "lib", "", "Unstripped libgni.so to use for frames without a build-id")
+	if err := symFlags.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if chdir != "." {
+		if err := os.Chdir(chdir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	s := newSymbolizer(outDir, lib)
+	if err := s.process(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,234 @@
+package symbolize
+
+import (
+	"bufio"
+	"debug/elf"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gni.dev/cmd/internal/build"
+	"gni.dev/cmd/internal/dbg/proc"
+)
+
+const gniLib = "libgni.so"
+
+var (
+	// Prefixes added by logcat in the threadtime and brief formats.
+	logcatThreadtime = regexp.MustCompile(`^\d\d-\d\d \d\d:\d\d:\d\d\.\d+\s+\d+\s+\d+ [VDIWEF] [^:]*: ?`)
+	logcatBrief      = regexp.MustCompile(`^[VDIWEF]/[^(]*\(\s*\d+\): ?`)
+
+	// A frame of an Android tombstone, e.g.
+	// #00 pc 000000000004a1c4  /data/app/.../lib/arm64/libgni.so (BuildId: 1234abcd)
+	tombstoneFrame = regexp.MustCompile(`#(\d+) pc ([0-9a-fA-F]+)\s+(\S+)(.*)$`)
+	buildIDAttr    = regexp.MustCompile(`\(BuildId: ([0-9a-fA-F]+)\)`)
+	// A library offset as printed by crash reporters, e.g. libgni.so+0x4a1c4.
+	libOffset = regexp.MustCompile(`(\S*` + regexp.QuoteMeta(gniLib) + `) ?\+ ?0x([0-9a-fA-F]+)`)
+
+	goroutineHeader = regexp.MustCompile(`^goroutine \d+ \[.*\]:$`)
+	goFuncLine      = regexp.MustCompile(`^(\S+)\(.*\)$`)
+	goCreatedBy     = regexp.MustCompile(`^created by (\S+)`)
+	goFileLine      = regexp.MustCompile(`^\s+(\S+\.go:\d+)(?: \+0x[0-9a-fA-F]+)?$`)
+)
+
+type nativeFrame struct {
+	num     int
+	pc      uint64
+	lib     string
+	rest    string
+	buildID string
+}
+
+func parseNativeFrame(line string) (nativeFrame, bool) {
+	m := tombstoneFrame.FindStringSubmatch(line)
+	if m == nil {
+		return nativeFrame{}, false
+	}
+	num, _ := strconv.Atoi(m[1])
+	pc, err := strconv.ParseUint(m[2], 16, 64)
+	if err != nil {
+		return nativeFrame{}, false
+	}
+	f := nativeFrame{num: num, pc: pc, lib: m[3], rest: strings.TrimSpace(m[4])}
+	if id := buildIDAttr.FindStringSubmatch(m[4]); id != nil {
+		f.buildID = strings.ToLower(id[1])
+	}
+	return f, true
+}
+
+func stripLogcat(line string) string {
+	if loc := logcatThreadtime.FindStringIndex(line); loc != nil {
+		return line[loc[1]:]
+	}
+	if loc := logcatBrief.FindStringIndex(line); loc != nil {
+		return line[loc[1]:]
+	}
+	return line
+}
+
+type symbolizer struct {
+	outDir string
+	lib    string
+	tables map[string]*proc.SymTable
+
+	inGoroutine bool
+	goFrame     int
+	goFunc      string
+	goFile      string
+	goCreator   bool
+}
+
+func newSymbolizer(outDir, lib string) *symbolizer {
+	return &symbolizer{
+		outDir: outDir,
+		lib:    lib,
+		tables: make(map[string]*proc.SymTable),
+	}
+}
+
+// process reads crash reports from r and writes them to w with the frames
+// of libgni.so resolved to functions and source lines.
+func (s *symbolizer) process(r io.Reader, w io.Writer) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		s.processLine(w, stripLogcat(sc.Text()))
+	}
+	s.flushGoFunc(w)
+	return sc.Err()
+}
+
+func (s *symbolizer) processLine(w io.Writer, line string) {
+	if f, ok := parseNativeFrame(line); ok {
+		fmt.Fprintln(w, s.nativeFrame(f))
+		return
+	}
+
+	if goroutineHeader.MatchString(line) {
+		s.flushGoFunc(w)
+		s.inGoroutine = true
+		s.goFrame = 0
+		fmt.Fprintln(w, line)
+		return
+	}
+	if s.inGoroutine {
+		if s.goFunc != "" {
+			if m := goFileLine.FindStringSubmatch(line); m != nil {
+				s.goFile = m[1]
+				s.flushGoFunc(w)
+				return
+			}
+			s.flushGoFunc(w)
+		}
+		if m := goFuncLine.FindStringSubmatch(line); m != nil {
+			s.goFunc = m[1]
+			return
+		}
+		if m := goCreatedBy.FindStringSubmatch(line); m != nil {
+			s.goFunc = m[1]
+			s.goCreator = true
+			return
+		}
+		if strings.TrimSpace(line) == "" {
+			s.inGoroutine = false
+		}
+	}
+
+	if m := libOffset.FindStringSubmatchIndex(line); m != nil {
+		pc, _ := strconv.ParseUint(line[m[4]:m[5]], 16, 64)
+		if loc, err := s.lookup("", pc); err == nil {
+			line = line[:m[1]] + " (" + loc + ")" + line[m[1]:]
+		}
+	}
+	fmt.Fprintln(w, line)
+}
+
+func (s *symbolizer) flushGoFunc(w io.Writer) {
+	if s.goFunc == "" {
+		return
+	}
+	frame := fmt.Sprintf("#%-2d %s", s.goFrame, s.goFunc)
+	if s.goCreator {
+		frame = "created by " + s.goFunc
+	}
+	if s.goFile != "" {
+		frame += " at " + s.goFile
+	}
+	fmt.Fprintf(w, "  %s\n", frame)
+	s.goFrame++
+	s.goFunc = ""
+	s.goFile = ""
+	s.goCreator = false
+}
+
+func (s *symbolizer) nativeFrame(f nativeFrame) string {
+	prefix := fmt.Sprintf("#%02d pc %016x  %s", f.num, f.pc, path.Base(f.lib))
+	if path.Base(f.lib) != gniLib {
+		return strings.TrimSpace(prefix + " " + f.rest)
+	}
+	loc, err := s.lookup(f.buildID, f.pc)
+	if err != nil {
+		return fmt.Sprintf("%s  ?? (%v)", prefix, err)
+	}
+	return prefix + "  " + loc
+}
+
+// lookup returns the function and source line for pc in the libgni.so with
+// the given build-id.
+func (s *symbolizer) lookup(buildID string, pc uint64) (string, error) {
+	sym, err := s.table(buildID)
+	if err != nil {
+		return "", err
+	}
+	file, line, fn, err := sym.PCToLine(pc)
+	if err != nil {
+		return "", err
+	}
+	name := "??"
+	if fn != nil {
+		name = fn.Name()
+	}
+	return fmt.Sprintf("%s at %s:%d", name, file, line), nil
+}
+
+func (s *symbolizer) table(buildID string) (*proc.SymTable, error) {
+	key := buildID
+	if key == "" {
+		key = s.lib
+	}
+	if sym, ok := s.tables[key]; ok {
+		return sym, nil
+	}
+
+	lib := s.lib
+	if buildID != "" {
+		var err error
+		if lib, err = build.FindSymbols(s.outDir, buildID); err != nil {
+			if s.lib == "" {
+				return nil, err
+			}
+			lib = s.lib
+		}
+	}
+	if lib == "" {
+		return nil, fmt.Errorf("no build-id, specify the library with -lib")
+	}
+
+	f, err := elf.Open(lib)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d, err := f.DWARF()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", lib, err)
+	}
+	sym := &proc.SymTable{}
+	if err := sym.LoadImage(d); err != nil {
+		return nil, err
+	}
+	s.tables[key] = sym
+	return sym, nil
+}
@@ -0,0 +1,98 @@
+package symbolize
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gni.dev/cmd/internal/dbg/proc"
+	"gni.dev/cmd/internal/dbg/test"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(test.Run(m))
+}
+
+var frameTests = []struct {
+	input string
+	want  nativeFrame
+	ok    bool
+}{
+	{
+		input: "    #00 pc 000000000004a1c4  /data/app/~~x==/dev.gni.app-y==/lib/arm64/libgni.so (BuildId: 0A1b2c)",
+		want: nativeFrame{
+			pc:      0x4a1c4,
+			lib:     "/data/app/~~x==/dev.gni.app-y==/lib/arm64/libgni.so",
+			rest:    "(BuildId: 0A1b2c)",
+			buildID: "0a1b2c",
+		},
+		ok: true,
+	},
+	{
+		input: "    #12 pc 00000000000e3c20  /apex/com.android.runtime/lib64/bionic/libc.so (abort+164)",
+		want: nativeFrame{
+			num:  12,
+			pc:   0xe3c20,
+			lib:  "/apex/com.android.runtime/lib64/bionic/libc.so",
+			rest: "(abort+164)",
+		},
+		ok: true,
+	},
+	{
+		input: "backtrace:",
+	},
+}
+
+func TestParseNativeFrame(t *testing.T) {
+	for i, test := range frameTests {
+		f, ok := parseNativeFrame(stripLogcat(test.input))
+		assert.Equal(t, test.ok, ok, "test #%d", i)
+		assert.Equal(t, test.want, f, "test #%d", i)
+	}
+}
+
+func TestStripLogcat(t *testing.T) {
+	assert.Equal(t, "#00 pc 0", stripLogcat("10-19 12:00:00.123  1234  1234 F DEBUG   : #00 pc 0"))
+	assert.Equal(t, "\tmain.go:1", stripLogcat("E/GoLog   ( 1234): \tmain.go:1"))
+	assert.Equal(t, "plain", stripLogcat("plain"))
+}
+
+func TestSymbolize(t *testing.T) {
+	fixt := test.Build("symbols")
+
+	f, err := elf.Open(fixt)
+	assert.NoError(t, err)
+	defer f.Close()
+	d, err := f.DWARF()
+	assert.NoError(t, err)
+	var sym proc.SymTable
+	assert.NoError(t, sym.LoadImage(d))
+	pc, file, err := sym.LineToPC("symbols.go", 24)
+	assert.NoError(t, err)
+
+	input := strings.Join([]string{
+		fmt.Sprintf("#00 pc %016x  /data/app/lib/x86_64/libgni.so", pc),
+		"#01 pc 0000000000001000  /system/lib64/libc.so (abort+4)",
+		"goroutine 1 [running]:",
+		"main.func2(...)",
+		"\t/src/main.go:24 +0x1c",
+		"created by main.main in goroutine 1",
+		"\t/src/main.go:30 +0x25",
+	}, "\n")
+	var out bytes.Buffer
+	s := newSymbolizer("", fixt)
+	assert.NoError(t, s.process(strings.NewReader(input), &out))
+
+	want := strings.Join([]string{
+		fmt.Sprintf("#00 pc %016x  libgni.so  main.func2 at %s:24", pc, file),
+		"#01 pc 0000000000001000  libc.so (abort+4)",
+		"goroutine 1 [running]:",
+		"  #0  main.func2 at /src/main.go:24",
+		"  created by main.main at /src/main.go:30",
+	}, "\n") + "\n"
+	assert.Equal(t, want, out.String())
+}